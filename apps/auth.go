@@ -0,0 +1,68 @@
+package apps
+
+import (
+	fba "analytics/firebase_auth"
+	"context"
+	"log"
+	"net/http"
+)
+
+type contextKey string
+
+// keyAuthContextKey holds the keyAuth of requests authenticated with an API key.
+const keyAuthContextKey contextKey = "keyAuth"
+
+// keyAuth is the app API key a request authenticated with instead of a Firebase token.
+type keyAuth struct {
+	AppID string
+	Key   APIKey
+}
+
+// AuthMiddleware authenticates dashboard requests with a Firebase token, and
+// server-to-server requests with an app API key in X-API-Key and no
+// Authorization header. Whether the key's scopes allow the request is checked
+// by authorizeApp.
+func (m *Manager) AuthMiddleware(next http.Handler) http.Handler {
+	firebase := fba.FirebaseAuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey := r.Header.Get("X-API-Key")
+		if apiKey == "" || r.Header.Get("Authorization") != "" {
+			firebase.ServeHTTP(w, r)
+			return
+		}
+
+		app, key, err := m.lookupAPIKey(apiKey)
+		if err != nil {
+			log.Printf("AuthMiddleware: Invalid API key from %s", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), keyAuthContextKey, keyAuth{AppID: app.ID, Key: key})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authorizeKey checks that a request authenticated with an API key targets the
+// key's app and that the key has the scope standing in for the required role.
+func (m *Manager) authorizeKey(w http.ResponseWriter, r *http.Request, handlerName string, auth keyAuth, required Role) (*App, bool) {
+	appID, err := extractAppID(r.URL.Path)
+	if err != nil {
+		http.Error(w, "invalid app ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	scope, ok := roleScopes[required]
+	if appID != auth.AppID || !ok || !auth.Key.HasScope(scope) {
+		log.Printf("%s: API key %s of app %s not authorized as %s for app %s", handlerName, auth.Key.ID, auth.AppID, required, appID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	app, exists := m.GetApp(appID)
+	if !exists {
+		http.Error(w, "App not found", http.StatusNotFound)
+		return nil, false
+	}
+	return app, true
+}
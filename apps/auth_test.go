@@ -0,0 +1,57 @@
+package apps
+
+import (
+	"analytics/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthMiddlewareScopes(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	app, _ := manager.CreateApp("scoped-app", nil, "alice", "")
+	other, _ := manager.CreateApp("other-app", nil, "alice", "")
+	ingestKey := app.Keys[0].Key
+	readKey, err := manager.IssueKey(app.ID, "backend", []Scope{ScopeReadEvents}, false, 0)
+	if err != nil {
+		t.Fatalf("Failed to issue key: %v", err)
+	}
+	adminKey, _ := manager.IssueKey(app.ID, "ops", []Scope{ScopeAdmin}, false, 0)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		key            string
+		expectedStatus int
+	}{
+		{"read key reads events", http.MethodGet, "/" + app.ID + "/events", readKey.Key, http.StatusOK},
+		{"read key aggregates", http.MethodGet, "/" + app.ID + "/aggregate", readKey.Key, http.StatusOK},
+		{"ingest key cannot read", http.MethodGet, "/" + app.ID + "/events", ingestKey, http.StatusForbidden},
+		{"read key of another app", http.MethodGet, "/" + other.ID + "/events", readKey.Key, http.StatusForbidden},
+		{"read key cannot list keys", http.MethodGet, "/" + app.ID + "/keys", readKey.Key, http.StatusForbidden},
+		{"admin key lists keys", http.MethodGet, "/" + app.ID + "/keys", adminKey.Key, http.StatusOK},
+		{"admin key reads events", http.MethodGet, "/" + app.ID + "/events", adminKey.Key, http.StatusOK},
+		{"admin key cannot delete app", http.MethodDelete, "/" + app.ID, adminKey.Key, http.StatusForbidden},
+		{"unknown key", http.MethodGet, "/" + app.ID + "/events", "nope", http.StatusUnauthorized},
+	}
+
+	handler := manager.AuthMiddleware(manager.CrudHandler())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/analytics/api/v1/apps"+tt.path, nil)
+			req.Header.Set("X-API-Key", tt.key)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Only ingest keys can send events
+	if _, err := manager.GetAppByAPIKey(readKey.Key, ScopeIngest); err == nil {
+		t.Errorf("Expected read key to be rejected for ingest")
+	}
+}
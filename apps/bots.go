@@ -0,0 +1,68 @@
+package apps
+
+import (
+	"fmt"
+	"time"
+)
+
+// BotPolicy is what the tracker does with events it classifies as coming from bots.
+type BotPolicy string
+
+const (
+	BotPolicyFlag     BotPolicy = "flag"     // store with is_bot set (default)
+	BotPolicyDrop     BotPolicy = "drop"     // discard
+	BotPolicySeparate BotPolicy = "separate" // store with is_bot set under BotsStoreID, apart from the app's events
+)
+
+// Valid reports whether p is a known policy. The empty policy means BotPolicyFlag.
+func (p BotPolicy) Valid() bool {
+	switch p {
+	case "", BotPolicyFlag, BotPolicyDrop, BotPolicySeparate:
+		return true
+	}
+	return false
+}
+
+// BotsStoreID is the event store namespace holding an app's bot events under BotPolicySeparate.
+func BotsStoreID(appID string) string {
+	return appID + ".bots"
+}
+
+// BotPolicy returns the bot policy of an app.
+func (m *Manager) BotPolicy(appID string) BotPolicy {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	if app, exists := m.data.Apps[appID]; exists && app.BotPolicy != "" {
+		return app.BotPolicy
+	}
+	return BotPolicyFlag
+}
+
+// RecordBot counts an event of an app classified as coming from a bot for reason.
+func (m *Manager) RecordBot(appID, reason string) {
+	m.usage.recordBot(appID, reason, time.Now())
+}
+
+// SetBotPolicy changes the bot policy of an app.
+func (m *Manager) SetBotPolicy(appID string, policy BotPolicy) error {
+	if !policy.Valid() {
+		return fmt.Errorf("invalid bot policy %q", policy)
+	}
+
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return fmt.Errorf("app %s not found", appID)
+	}
+
+	previous := app.BotPolicy
+	app.BotPolicy = policy
+	if err := m.save(); err != nil {
+		app.BotPolicy = previous // Rollback on save failure
+		return fmt.Errorf("save bot policy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"analytics/models"
+)
+
+const (
+	// catalogFlushInterval is how often a changed catalogue is written to disk.
+	catalogFlushInterval = 10 * time.Second
+
+	// Bounds keeping a misbehaving app from growing the catalogue without limit.
+	maxCatalogEvents     = 1000 // event names per app
+	maxCatalogProperties = 200  // property keys per event name
+	maxCatalogSamples    = 5    // distinct sample values per property
+	maxCatalogSampleLen  = 64   // runes of a string sample; longer strings are not kept
+)
+
+// PropertySummary describes the values seen for one property key of an event.
+type PropertySummary struct {
+	Types     []string      `json:"types"` // JSON types seen, sorted
+	FirstSeen time.Time     `json:"first_seen"`
+	LastSeen  time.Time     `json:"last_seen"`
+	Samples   []interface{} `json:"samples,omitempty"` // distinct short strings, numbers and booleans, first seen first
+}
+
+// EventSummary describes the events seen with one event name.
+type EventSummary struct {
+	Name       string                      `json:"name"`
+	EventTypes []string                    `json:"event_types"` // sorted
+	FirstSeen  time.Time                   `json:"first_seen"`
+	LastSeen   time.Time                   `json:"last_seen"`
+	Properties map[string]*PropertySummary `json:"properties"`
+}
+
+// catalog records, per app, the event names and property keys that pass
+// through AddEvent, persisted to a JSON file. Recording an event twice changes
+// nothing, so replaying recent events on startup is harmless. Events reach
+// AddEvent after redaction, so samples never hold redacted values. A nil
+// *catalog records nothing.
+type catalog struct {
+	mu    sync.Mutex
+	path  string                              // "" keeps the catalogue in memory only
+	apps  map[string]map[string]*EventSummary // appID -> event name -> summary
+	dirty bool
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newCatalog loads the catalogue at path and starts flushing it periodically.
+func newCatalog(path string) (*catalog, error) {
+	c := &catalog{
+		path: path,
+		apps: make(map[string]map[string]*EventSummary),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read catalog: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &c.apps); err != nil {
+				return nil, fmt.Errorf("parse catalog: %w", err)
+			}
+		}
+	}
+
+	go c.flushLoop()
+	return c, nil
+}
+
+func (c *catalog) flushLoop() {
+	defer close(c.done)
+	ticker := time.NewTicker(catalogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.flush(); err != nil {
+				log.Printf("catalog: Failed to flush catalog: %v", err)
+			}
+		}
+	}
+}
+
+// close stops the periodic flush and writes any pending changes.
+func (c *catalog) close() error {
+	close(c.stop)
+	<-c.done
+	return c.flush()
+}
+
+// flush writes the catalogue if it changed.
+func (c *catalog) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty || c.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.apps)
+	if err != nil {
+		return fmt.Errorf("marshal catalog: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write catalog: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("write catalog: %w", err)
+	}
+
+	c.dirty = false
+	return nil
+}
+
+// record adds the event name, type and property keys of an event. String
+// values are kept as samples only if strings is set.
+func (c *catalog) record(event *models.Event, strings bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	events := c.apps[event.AppID]
+	if events == nil {
+		events = make(map[string]*EventSummary)
+		c.apps[event.AppID] = events
+	}
+
+	seen := event.Timestamp.UTC()
+	summary, exists := events[event.EventName]
+	if !exists {
+		if len(events) >= maxCatalogEvents {
+			return
+		}
+		summary = &EventSummary{
+			Name:       event.EventName,
+			EventTypes: []string{},
+			FirstSeen:  seen,
+			LastSeen:   seen,
+			Properties: make(map[string]*PropertySummary),
+		}
+		events[event.EventName] = summary
+		c.dirty = true
+	}
+	c.dirty = widenSeen(&summary.FirstSeen, &summary.LastSeen, seen) || c.dirty
+	c.dirty = addSorted(&summary.EventTypes, event.EventType) || c.dirty
+
+	for key, value := range event.Properties {
+		property, exists := summary.Properties[key]
+		if !exists {
+			if len(summary.Properties) >= maxCatalogProperties {
+				continue
+			}
+			property = &PropertySummary{Types: []string{}, FirstSeen: seen, LastSeen: seen}
+			summary.Properties[key] = property
+			c.dirty = true
+		}
+		c.dirty = widenSeen(&property.FirstSeen, &property.LastSeen, seen) || c.dirty
+		c.dirty = addSorted(&property.Types, jsonType(value)) || c.dirty
+		c.dirty = addSample(property, value, strings) || c.dirty
+	}
+}
+
+// events returns copies of an app's event summaries, sorted by name.
+func (c *catalog) events(appID string) []EventSummary {
+	if c == nil {
+		return []EventSummary{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	events := make([]EventSummary, 0, len(c.apps[appID]))
+	for _, summary := range c.apps[appID] {
+		copied := *summary
+		copied.EventTypes = slices.Clone(summary.EventTypes)
+		copied.Properties = make(map[string]*PropertySummary, len(summary.Properties))
+		for key, property := range summary.Properties {
+			p := *property
+			p.Types = slices.Clone(property.Types)
+			p.Samples = slices.Clone(property.Samples)
+			copied.Properties[key] = &p
+		}
+		events = append(events, copied)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
+
+// clearSamples drops the sample values of an app, which may have come from
+// the events of an erased user. They are collected again from new events.
+func (c *catalog) clearSamples(appID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, summary := range c.apps[appID] {
+		for _, property := range summary.Properties {
+			if property.Samples != nil {
+				property.Samples = nil
+				c.dirty = true
+			}
+		}
+	}
+}
+
+func (c *catalog) forget(appID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.apps[appID]; exists {
+		delete(c.apps, appID)
+		c.dirty = true
+	}
+}
+
+// widenSeen extends [first, last] to include seen and reports whether it changed.
+func widenSeen(first, last *time.Time, seen time.Time) bool {
+	changed := false
+	if seen.Before(*first) {
+		*first = seen
+		changed = true
+	}
+	if seen.After(*last) {
+		*last = seen
+		changed = true
+	}
+	return changed
+}
+
+// addSorted inserts value into a sorted set and reports whether it was missing.
+func addSorted(values *[]string, value string) bool {
+	i, found := slices.BinarySearch(*values, value)
+	if found {
+		return false
+	}
+	*values = slices.Insert(*values, i, value)
+	return true
+}
+
+// addSample keeps a string, number or boolean as a sample if it is new and
+// there is room. Strings are kept only if strings is set and they are at most
+// maxCatalogSampleLen runes long, as long ones are free text rather than
+// values worth suggesting.
+func addSample(property *PropertySummary, value interface{}, strings bool) bool {
+	switch v := value.(type) {
+	case float64, bool:
+	case string:
+		if !strings || utf8.RuneCountInString(v) > maxCatalogSampleLen {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if len(property.Samples) >= maxCatalogSamples || slices.Contains(property.Samples, value) {
+		return false
+	}
+	property.Samples = append(property.Samples, value)
+	return true
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// CatalogHandler returns the event names and property keys an app has sent,
+// with their observed types, first and last seen times and sample values.
+func (m *Manager) CatalogHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("CatalogHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		appID, err := extractAppID(r.URL.Path)
+		if err != nil {
+			http.Error(w, "invalid app ID", http.StatusBadRequest)
+			return
+		}
+		if _, exists := m.GetApp(appID); !exists {
+			http.Error(w, "App not found", http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, "CatalogHandler", http.StatusOK, map[string]interface{}{
+			"events": m.catalog.events(appID),
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package apps
+
+import (
+	"analytics/config"
+	"analytics/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCatalogRecord(t *testing.T) {
+	c, err := newCatalog("")
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	defer c.close()
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []*models.Event{
+		{AppID: "a", EventType: models.EventTypeCustom, EventName: "checkout", Timestamp: base, Properties: map[string]interface{}{"amount": 9.5, "coupon": "SPRING", "note": strings.Repeat("x", maxCatalogSampleLen+1)}},
+		{AppID: "a", EventType: models.EventTypePurchase, EventName: "checkout", Timestamp: base.Add(time.Hour), Properties: map[string]interface{}{"amount": "9.50"}},
+		{AppID: "a", EventType: models.EventTypeCustom, EventName: "checkout", Timestamp: base.Add(-time.Hour), Properties: map[string]interface{}{"amount": 9.5}},
+		{AppID: "b", EventType: models.EventTypeCustom, EventName: "other", Timestamp: base},
+	}
+	for _, event := range events {
+		c.record(event, true)
+	}
+	// Replaying is harmless
+	c.record(events[0], true)
+
+	got := c.events("a")
+	if len(got) != 1 || got[0].Name != "checkout" {
+		t.Fatalf("Expected only checkout for app a, got %+v", got)
+	}
+	summary := got[0]
+	if expected := []string{models.EventTypeCustom, models.EventTypePurchase}; !reflect.DeepEqual(summary.EventTypes, expected) {
+		t.Errorf("Expected event types %v, got %v", expected, summary.EventTypes)
+	}
+	if !summary.FirstSeen.Equal(base.Add(-time.Hour)) || !summary.LastSeen.Equal(base.Add(time.Hour)) {
+		t.Errorf("Expected seen from %v to %v, got %v to %v", base.Add(-time.Hour), base.Add(time.Hour), summary.FirstSeen, summary.LastSeen)
+	}
+
+	amount := summary.Properties["amount"]
+	if amount == nil {
+		t.Fatalf("Expected amount property, got %+v", summary.Properties)
+	}
+	if expected := []string{"number", "string"}; !reflect.DeepEqual(amount.Types, expected) {
+		t.Errorf("Expected amount types %v, got %v", expected, amount.Types)
+	}
+	if expected := []interface{}{9.5, "9.50"}; !reflect.DeepEqual(amount.Samples, expected) {
+		t.Errorf("Expected amount samples %v, got %v", expected, amount.Samples)
+	}
+
+	// Returned summaries are copies
+	amount.Types[0] = "changed"
+	if c.events("a")[0].Properties["amount"].Types[0] != "number" {
+		t.Error("Expected catalog to be unaffected by changes to returned summaries")
+	}
+
+	if coupon := summary.Properties["coupon"]; coupon == nil || !reflect.DeepEqual(coupon.Samples, []interface{}{"SPRING"}) {
+		t.Errorf("Expected coupon sample SPRING, got %+v", coupon)
+	}
+	if note := summary.Properties["note"]; note == nil || len(note.Samples) != 0 {
+		t.Errorf("Expected long note without samples, got %+v", note)
+	}
+
+	// Apps opting out keep no string samples
+	c.record(&models.Event{AppID: "c", EventType: models.EventTypeCustom, EventName: "signup", Timestamp: base, Properties: map[string]interface{}{"plan": "pro", "seats": 3.0}}, false)
+	if plan := c.events("c")[0].Properties["plan"]; len(plan.Samples) != 0 {
+		t.Errorf("Expected no string samples when opted out, got %v", plan.Samples)
+	}
+	if seats := c.events("c")[0].Properties["seats"]; !reflect.DeepEqual(seats.Samples, []interface{}{3.0}) {
+		t.Errorf("Expected number samples when opted out, got %v", seats.Samples)
+	}
+
+	c.clearSamples("a")
+	if samples := c.events("a")[0].Properties["amount"].Samples; len(samples) != 0 {
+		t.Errorf("Expected no samples after clearing, got %v", samples)
+	}
+
+	c.forget("a")
+	if got := c.events("a"); len(got) != 0 {
+		t.Errorf("Expected no events after forget, got %+v", got)
+	}
+	if got := c.events("b"); len(got) != 1 {
+		t.Errorf("Expected app b to be kept, got %+v", got)
+	}
+}
+
+func TestCatalogPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	c, err := newCatalog(path)
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	c.record(&models.Event{AppID: "a", EventType: models.EventTypeCustom, EventName: "signup", Timestamp: time.Now(), Properties: map[string]interface{}{"plan": "pro"}}, true)
+	if err := c.close(); err != nil {
+		t.Fatalf("Failed to close catalog: %v", err)
+	}
+
+	reopened, err := newCatalog(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen catalog: %v", err)
+	}
+	defer reopened.close()
+	got := reopened.events("a")
+	if len(got) != 1 || got[0].Properties["plan"] == nil {
+		t.Errorf("Expected signup with plan after reopening, got %+v", got)
+	}
+}
+
+func TestCatalogHandler(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	app, _ := manager.CreateApp("catalog-app", nil, "alice", "")
+
+	manager.AddEvent(&models.Event{
+		EventID:    "e1",
+		AppID:      app.ID,
+		EventType:  models.EventTypeClick,
+		EventName:  "cta",
+		Timestamp:  time.Now(),
+		Properties: map[string]interface{}{"label": "Buy", "tags": []interface{}{"x"}},
+	})
+
+	request := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps/"+app.ID+"/schema", nil)
+		w := httptest.NewRecorder()
+		manager.CrudHandler()(w, withUser(req, user))
+		return w
+	}
+
+	w := request("alice")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Events []EventSummary `json:"events"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Name != "cta" {
+		t.Fatalf("Expected cta event, got %+v", resp.Events)
+	}
+	if tags := resp.Events[0].Properties["tags"]; tags == nil || !reflect.DeepEqual(tags.Types, []string{"array"}) || len(tags.Samples) != 0 {
+		t.Errorf("Expected tags typed array without samples, got %+v", tags)
+	}
+
+	if label := resp.Events[0].Properties["label"]; label == nil || !reflect.DeepEqual(label.Samples, []interface{}{"Buy"}) {
+		t.Errorf("Expected label sample Buy, got %+v", label)
+	}
+
+	// Opting out clears the samples and keeps strings out of new ones
+	if err := manager.SetPrivacy(app.ID, Privacy{NoStringSamples: true}); err != nil {
+		t.Fatalf("Failed to set privacy: %v", err)
+	}
+	manager.AddEvent(&models.Event{EventID: "e2", AppID: app.ID, EventType: models.EventTypeClick, EventName: "cta", Timestamp: time.Now(), Properties: map[string]interface{}{"label": "Sell"}})
+	if label := manager.catalog.events(app.ID)[0].Properties["label"]; len(label.Samples) != 0 {
+		t.Errorf("Expected no label samples after opting out, got %v", label.Samples)
+	}
+
+	if w := request("mallory"); w.Code != http.StatusForbidden && w.Code != http.StatusNotFound {
+		t.Errorf("Expected outsider to be refused, got %d", w.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package apps
+
+import (
+	"analytics/models"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// eventCursor marks the last event of a page. Events are ordered by timestamp,
+// then event ID, so the next page starts strictly after this position.
+type eventCursor struct {
+	Timestamp int64  `json:"t"` // unix nanoseconds
+	EventID   string `json:"id"`
+}
+
+// encodeCursor returns the opaque continuation token for the position of event.
+func encodeCursor(event models.Event) string {
+	data, _ := json.Marshal(eventCursor{
+		Timestamp: event.Timestamp.UnixNano(),
+		EventID:   event.EventID,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*eventCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c eventCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+// time returns the timestamp of the cursor position.
+func (c *eventCursor) time() time.Time {
+	return time.Unix(0, c.Timestamp).UTC()
+}
+
+// after reports whether event comes after the cursor position.
+func (c *eventCursor) after(event models.Event) bool {
+	ts := event.Timestamp.UnixNano()
+	if ts != c.Timestamp {
+		return ts > c.Timestamp
+	}
+	return event.EventID > c.EventID
+}
+
+// sortEvents orders events by timestamp, then event ID, the order used by cursors.
+func sortEvents(events []models.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Timestamp.Equal(events[j].Timestamp) {
+			return events[i].Timestamp.Before(events[j].Timestamp)
+		}
+		return events[i].EventID < events[j].EventID
+	})
+}
+
+// paginate cuts sorted events to limit and returns the cursor for the next page,
+// or "" when there are no more events. A limit of 0 returns all events.
+func paginate(events []models.Event, limit int) ([]models.Event, string) {
+	if limit <= 0 || len(events) <= limit {
+		return events, ""
+	}
+	page := events[:limit]
+	return page, encodeCursor(page[limit-1])
+}
@@ -0,0 +1,106 @@
+package apps
+
+import (
+	"analytics/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	event := models.Event{EventID: "event-b", Timestamp: time.Date(2025, 8, 24, 12, 0, 0, 500, time.UTC)}
+
+	cursor, err := decodeCursor(encodeCursor(event))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	same := models.Event{EventID: "event-b", Timestamp: event.Timestamp}
+	laterID := models.Event{EventID: "event-c", Timestamp: event.Timestamp}
+	earlierID := models.Event{EventID: "event-a", Timestamp: event.Timestamp}
+	later := models.Event{EventID: "event-a", Timestamp: event.Timestamp.Add(time.Nanosecond)}
+
+	if cursor.after(same) || cursor.after(earlierID) {
+		t.Errorf("Expected cursor to exclude events at or before its position")
+	}
+	if !cursor.after(laterID) || !cursor.after(later) {
+		t.Errorf("Expected cursor to include events after its position")
+	}
+
+	if _, err := decodeCursor("not a cursor"); err == nil {
+		t.Errorf("Expected error for invalid cursor")
+	}
+}
+
+func TestGetEventsPaginatesAcrossDays(t *testing.T) {
+	tempDir := t.TempDir()
+	appID := "paged-app"
+	baseTime := time.Date(2025, 8, 20, 23, 0, 0, 0, time.UTC)
+
+	// Two events an hour over three days, with duplicate timestamps to exercise the ID tiebreak
+	expected := make([]string, 0)
+	for i := 0; i < 60; i++ {
+		ts := baseTime.Add(time.Duration(i/2) * time.Hour)
+		event := models.Event{EventID: fmt.Sprintf("event%02d", i), Timestamp: ts}
+		dirPath := filepath.Join(tempDir, "data", appID, ts.Format("20060102"))
+		os.MkdirAll(dirPath, 0755)
+		data, _ := json.Marshal(event)
+		os.WriteFile(filepath.Join(dirPath, event.EventID+".json"), data, 0644)
+		expected = append(expected, event.EventID)
+	}
+	// Outside the requested end
+	late := models.Event{EventID: "late", Timestamp: baseTime.Add(10 * 24 * time.Hour)}
+	lateDir := filepath.Join(tempDir, "data", appID, late.Timestamp.Format("20060102"))
+	os.MkdirAll(lateDir, 0755)
+	data, _ := json.Marshal(late)
+	os.WriteFile(filepath.Join(lateDir, "late.json"), data, 0644)
+
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	manager := &Manager{events: newTestFileStore(t), caches: make(map[string]*EventCache)}
+
+	q := eventsQuery{
+		AppID:        appID,
+		StartMinutes: toMinutesSinceEpoch(baseTime),
+		EndMinutes:   toMinutesSinceEpoch(baseTime.Add(5 * 24 * time.Hour)),
+		Limit:        7,
+	}
+
+	got := make([]string, 0)
+	for pages := 0; ; pages++ {
+		if pages > 20 {
+			t.Fatalf("Pagination did not terminate")
+		}
+		events, next, err := manager.getEvents(q)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(events) > q.Limit {
+			t.Fatalf("Expected at most %d events, got %d", q.Limit, len(events))
+		}
+		for _, event := range events {
+			got = append(got, event.EventID)
+		}
+		if next == "" {
+			break
+		}
+		q.Cursor, err = decodeCursor(next)
+		if err != nil {
+			t.Fatalf("Unexpected cursor error: %v", err)
+		}
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %v", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %s at position %d, got %s", expected[i], i, got[i])
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package apps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"analytics/models"
+)
+
+// ErasureStatus is the state of an erasure job.
+type ErasureStatus string
+
+const (
+	ErasureRunning ErasureStatus = "running"
+	ErasureDone    ErasureStatus = "done"
+	ErasureFailed  ErasureStatus = "failed"
+)
+
+// maxErasureJobsPerApp bounds the finished jobs kept per app.
+const maxErasureJobsPerApp = 100
+
+// ErasureJob reports the progress of deleting the events of one user of an app.
+// The user's identifiers are not kept in the job, only which kinds were given.
+type ErasureJob struct {
+	ID          string        `json:"id"`
+	AppID       string        `json:"app_id"`
+	Fields      []string      `json:"fields"` // "user_id" and/or "anonymous_id"
+	Status      ErasureStatus `json:"status"`
+	Scanned     int64         `json:"scanned"` // events examined so far
+	Deleted     int64         `json:"deleted"` // events removed from the event store so far
+	Error       string        `json:"error,omitempty"`
+	RequestedBy string        `json:"requested_by,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	FinishedAt  *time.Time    `json:"finished_at,omitempty"`
+}
+
+// Erasure identifies a user whose events are erased: any event with this user
+// ID or this anonymous ID matches.
+type Erasure struct {
+	UserID      string `json:"user_id,omitempty"`
+	AnonymousID string `json:"anonymous_id,omitempty"`
+}
+
+// tombstoneKeys returns the keys under which an erased user is recorded.
+func (e Erasure) tombstoneKeys() []string {
+	var keys []string
+	if e.UserID != "" {
+		keys = append(keys, tombstoneKey("user_id", e.UserID))
+	}
+	if e.AnonymousID != "" {
+		keys = append(keys, tombstoneKey("anonymous_id", e.AnonymousID))
+	}
+	return keys
+}
+
+// erasedBy reports whether an event belongs to a user recorded under one of keys.
+func erasedBy(keys map[string]bool, event *models.Event) bool {
+	for _, key := range (Erasure{UserID: event.User.ID, AnonymousID: event.User.AnonymousID}).tombstoneKeys() {
+		if keys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// tombstoneKey hashes an identifier, so the tombstones of erased users do not
+// themselves keep the identifiers around.
+func tombstoneKey(field, value string) string {
+	sum := sha256.Sum256([]byte(field + ":" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// PendingErasure is an erasure job saved with its app until it succeeds, so
+// that a restart resumes it. The user is identified by tombstone keys only.
+type PendingErasure struct {
+	JobID       string    `json:"job_id"`
+	Keys        []string  `json:"keys"`
+	Fields      []string  `json:"fields"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// erasureJobs keeps the erasure jobs of each app in memory. Jobs still
+// pending in the app metadata are added again by resumeErasures; the progress
+// and the finished jobs of earlier runs are not kept.
+type erasureJobs struct {
+	mu      sync.Mutex
+	apps    map[string][]*ErasureJob // appID -> jobs, oldest first
+	running sync.WaitGroup
+}
+
+func (j *erasureJobs) add(job *ErasureJob) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.apps == nil {
+		j.apps = make(map[string][]*ErasureJob)
+	}
+	jobs := append(j.apps[job.AppID], job)
+	// Drop the oldest finished jobs beyond the limit; running ones are always kept
+	for excess := len(jobs) - maxErasureJobsPerApp; excess > 0; excess-- {
+		i := 0
+		for i < len(jobs) && jobs[i].Status == ErasureRunning {
+			i++
+		}
+		if i == len(jobs) {
+			break
+		}
+		jobs = append(jobs[:i], jobs[i+1:]...)
+	}
+	j.apps[job.AppID] = jobs
+}
+
+// update changes a job under the lock.
+func (j *erasureJobs) update(job *ErasureJob, fn func(job *ErasureJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(job)
+}
+
+// list returns copies of the jobs of an app, newest first.
+func (j *erasureJobs) list(appID string) []ErasureJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stored := j.apps[appID]
+	jobs := make([]ErasureJob, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		jobs = append(jobs, *stored[i])
+	}
+	return jobs
+}
+
+// get returns a copy of a job of an app.
+func (j *erasureJobs) get(appID, jobID string) (ErasureJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range j.apps[appID] {
+		if job.ID == jobID {
+			return *job, true
+		}
+	}
+	return ErasureJob{}, false
+}
+
+func (j *erasureJobs) forget(appID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.apps, appID)
+}
+
+// wait blocks until running jobs are finished.
+func (j *erasureJobs) wait() {
+	j.running.Wait()
+}
+
+// IsErased reports whether an event belongs to a user of its app whose events were erased.
+func (m *Manager) IsErased(appID string, event *models.Event) bool {
+	if event.User.ID == "" && event.User.AnonymousID == "" {
+		return false
+	}
+
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists || len(app.Tombstones) == 0 {
+		return false
+	}
+	for _, key := range (Erasure{UserID: event.User.ID, AnonymousID: event.User.AnonymousID}).tombstoneKeys() {
+		if _, erased := app.Tombstones[key]; erased {
+			return true
+		}
+	}
+	return false
+}
+
+// StartErasure records a tombstone for a user of an app, so that the tracker
+// drops the user's later events, and starts a job deleting the user's events
+// from the cache and the event store, bot events included. The job is saved
+// with the tombstone and resumed after a restart until it succeeds.
+func (m *Manager) StartErasure(appID string, erasure Erasure, requestedBy string) (ErasureJob, error) {
+	if erasure.UserID == "" && erasure.AnonymousID == "" {
+		return ErasureJob{}, fmt.Errorf("user_id or anonymous_id is required")
+	}
+	id, err := GenerateUUIDv7()
+	if err != nil {
+		return ErasureJob{}, fmt.Errorf("generate job ID: %w", err)
+	}
+
+	pending := &PendingErasure{
+		JobID:       id,
+		Keys:        erasure.tombstoneKeys(),
+		RequestedBy: requestedBy,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if erasure.UserID != "" {
+		pending.Fields = append(pending.Fields, "user_id")
+	}
+	if erasure.AnonymousID != "" {
+		pending.Fields = append(pending.Fields, "anonymous_id")
+	}
+	if err := m.addErasure(appID, pending); err != nil {
+		return ErasureJob{}, err
+	}
+	return m.startJob(appID, pending), nil
+}
+
+// startJob adds a running job for a pending erasure and starts it.
+func (m *Manager) startJob(appID string, pending *PendingErasure) ErasureJob {
+	job := &ErasureJob{
+		ID:          pending.JobID,
+		AppID:       appID,
+		Fields:      pending.Fields,
+		Status:      ErasureRunning,
+		RequestedBy: pending.RequestedBy,
+		CreatedAt:   pending.CreatedAt,
+	}
+	m.erasures.add(job)
+	started := *job
+
+	m.erasures.running.Add(1)
+	go func() {
+		defer m.erasures.running.Done()
+		m.runErasure(job, pending.Keys)
+	}()
+	return started
+}
+
+// resumeErasures restarts the jobs left pending by a previous run.
+func (m *Manager) resumeErasures() {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	for appID, app := range m.data.Apps {
+		for _, pending := range app.PendingErasures {
+			log.Printf("resumeErasures: Resuming job %s for app %s", pending.JobID, appID)
+			m.startJob(appID, pending)
+		}
+	}
+}
+
+// addErasure records the tombstones and the pending job of an erasure.
+func (m *Manager) addErasure(appID string, pending *PendingErasure) error {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return fmt.Errorf("app %s not found", appID)
+	}
+
+	var added []string
+	if app.Tombstones == nil {
+		app.Tombstones = make(map[string]time.Time)
+	}
+	for _, key := range pending.Keys {
+		if _, exists := app.Tombstones[key]; !exists {
+			app.Tombstones[key] = pending.CreatedAt
+			added = append(added, key)
+		}
+	}
+	app.PendingErasures = append(app.PendingErasures, pending)
+	if err := m.save(); err != nil {
+		// Rollback on save failure
+		for _, key := range added {
+			delete(app.Tombstones, key)
+		}
+		app.PendingErasures = app.PendingErasures[:len(app.PendingErasures)-1]
+		return fmt.Errorf("save tombstone: %w", err)
+	}
+	return nil
+}
+
+// finishErasure removes a pending job once it has succeeded.
+func (m *Manager) finishErasure(appID, jobID string) error {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return nil // deleted along with the app
+	}
+	for i, pending := range app.PendingErasures {
+		if pending.JobID != jobID {
+			continue
+		}
+		previous := app.PendingErasures
+		app.PendingErasures = slices.Delete(slices.Clone(previous), i, i+1)
+		if err := m.save(); err != nil {
+			app.PendingErasures = previous // Rollback on save failure
+			return fmt.Errorf("save pending erasures: %w", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// runErasure deletes the events of the user recorded under keys, updating the
+// job as it goes. A failed job stays pending and is retried after a restart.
+func (m *Manager) runErasure(job *ErasureJob, keys []string) {
+	log.Printf("runErasure: Starting job %s for app %s", job.ID, job.AppID)
+
+	erased := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		erased[key] = true
+	}
+	matches := func(event *models.Event) bool { return erasedBy(erased, event) }
+
+	m.cachesMu.RLock()
+	cache := m.caches[job.AppID]
+	m.cachesMu.RUnlock()
+	if cache != nil {
+		// Cached events are copies of stored ones, so they are not counted
+		cache.Remove(matches)
+	}
+	// Samples are not linked to users, so the whole app's are dropped
+	m.catalog.clearSamples(job.AppID)
+
+	match := func(event *models.Event) bool {
+		matched := matches(event)
+		m.erasures.update(job, func(job *ErasureJob) { job.Scanned++ })
+		return matched
+	}
+
+	var err error
+	for _, storeID := range []string{job.AppID, BotsStoreID(job.AppID)} {
+		var deleted int
+		deleted, err = m.events.Delete(storeID, match)
+		m.erasures.update(job, func(job *ErasureJob) { job.Deleted += int64(deleted) })
+		if err != nil {
+			err = fmt.Errorf("delete events: %w", err)
+			break
+		}
+	}
+	if err == nil {
+		err = m.finishErasure(job.AppID, job.ID)
+	}
+
+	m.erasures.update(job, func(job *ErasureJob) {
+		finished := time.Now().UTC()
+		job.FinishedAt = &finished
+		job.Status = ErasureDone
+		if err != nil {
+			job.Status = ErasureFailed
+			job.Error = err.Error()
+		}
+	})
+	if err != nil {
+		log.Printf("runErasure: Job %s for app %s failed: %v", job.ID, job.AppID, err)
+		return
+	}
+	log.Printf("runErasure: Finished job %s for app %s", job.ID, job.AppID)
+}
+
+func isErasuresPath(path string) bool {
+	sub := appSubPath(path)
+	return sub == "erasures" || strings.HasPrefix(sub, "erasures/")
+}
+
+// ErasuresHandler erases the events of users of an app; CrudHandler has
+// already checked that the user is an admin.
+//   - POST /apps/<id>/erasures: start a job for {"user_id"} and/or {"anonymous_id"}
+//   - GET /apps/<id>/erasures: the app's jobs, newest first
+//   - GET /apps/<id>/erasures/<job>: one job
+func (m *Manager) ErasuresHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("ErasuresHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		appID, err := extractAppID(r.URL.Path)
+		if err != nil {
+			http.Error(w, "invalid app ID", http.StatusBadRequest)
+			return
+		}
+		jobID := strings.Trim(strings.TrimPrefix(appSubPath(r.URL.Path), "erasures"), "/")
+
+		switch {
+		case r.Method == http.MethodPost && jobID == "":
+			var erasure Erasure
+			if err := json.NewDecoder(r.Body).Decode(&erasure); err != nil {
+				log.Printf("ErasuresHandler: Invalid request body: %v", err)
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if erasure.UserID == "" && erasure.AnonymousID == "" {
+				http.Error(w, "user_id or anonymous_id is required", http.StatusBadRequest)
+				return
+			}
+
+			requestedBy := ""
+			if user, ok := identityFromContext(r); ok {
+				requestedBy = user.UserID
+			}
+			job, err := m.StartErasure(appID, erasure, requestedBy)
+			if err != nil {
+				log.Printf("ErasuresHandler: Failed to start erasure: %v", err)
+				http.Error(w, "Failed to start erasure", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Location", r.URL.Path+"/"+job.ID)
+			writeJSON(w, "ErasuresHandler", http.StatusAccepted, job)
+
+		case r.Method == http.MethodGet && jobID == "":
+			writeJSON(w, "ErasuresHandler", http.StatusOK, m.erasures.list(appID))
+
+		case r.Method == http.MethodGet:
+			job, exists := m.erasures.get(appID, jobID)
+			if !exists {
+				http.Error(w, "Job not found", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, "ErasuresHandler", http.StatusOK, job)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package apps
+
+import (
+	"analytics/config"
+	"analytics/models"
+	"analytics/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErasuresHandler(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	org, _ := manager.CreateOrg("team", "alice")
+	manager.SetMember(org.ID, "bob", "", RoleViewer)
+	app, _ := manager.CreateApp("erasure-app", nil, "alice", org.ID)
+
+	now := time.Now().UTC()
+	events := []*models.Event{
+		{EventID: "1", AppID: app.ID, Timestamp: now, User: models.UserInfo{ID: "u1"}, Properties: map[string]interface{}{"age": 41.0}},
+		{EventID: "2", AppID: app.ID, Timestamp: now.Add(-48 * time.Hour), User: models.UserInfo{ID: "u1", AnonymousID: "a1"}},
+		{EventID: "3", AppID: app.ID, Timestamp: now, User: models.UserInfo{AnonymousID: "a1"}},
+		{EventID: "4", AppID: app.ID, Timestamp: now, User: models.UserInfo{ID: "u2"}},
+	}
+	for _, event := range events {
+		manager.AddEvent(event)
+		if err := manager.events.Append(app.ID, event); err != nil {
+			t.Fatalf("Failed to append event: %v", err)
+		}
+	}
+	bot := &models.Event{EventID: "5", AppID: app.ID, Timestamp: now, User: models.UserInfo{ID: "u1"}, IsBot: true}
+	manager.events.Append(BotsStoreID(app.ID), bot)
+
+	request := func(method, path, body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/analytics/api/v1/apps/"+app.ID+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		manager.CrudHandler()(w, withUser(req, user))
+		return w
+	}
+
+	if w := request(http.MethodPost, "/erasures", `{"user_id":"u1"}`, "bob"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for viewer, got %d", w.Code)
+	}
+	if w := request(http.MethodPost, "/erasures", `{}`, "alice"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without identifier, got %d", w.Code)
+	}
+
+	w := request(http.MethodPost, "/erasures", `{"user_id":"u1","anonymous_id":"a1"}`, "alice")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job ErasureJob
+	json.NewDecoder(w.Body).Decode(&job)
+	if job.ID == "" || job.RequestedBy != "alice" {
+		t.Fatalf("Expected job requested by alice, got %+v", job)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == ErasureRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		w := request(http.MethodGet, "/erasures/"+job.ID, "", "alice")
+		json.NewDecoder(w.Body).Decode(&job)
+	}
+	if job.Status != ErasureDone || job.Deleted != 4 || job.Scanned != 5 {
+		t.Fatalf("Expected job done with 4 of 5 events deleted, got %+v", job)
+	}
+	if strings.Contains(request(http.MethodGet, "/erasures", "", "alice").Body.String(), "u1") {
+		t.Error("Expected job listing not to contain the erased identifier")
+	}
+
+	var remaining []string
+	manager.events.Scan(app.ID, now.Add(-72*time.Hour), now.Add(time.Hour), func(event models.Event) error {
+		remaining = append(remaining, event.EventID)
+		return nil
+	})
+	manager.events.Scan(BotsStoreID(app.ID), now.Add(-72*time.Hour), now.Add(time.Hour), func(event models.Event) error {
+		remaining = append(remaining, event.EventID)
+		return nil
+	})
+	if len(remaining) != 1 || remaining[0] != "4" {
+		t.Errorf("Expected only event 4 on disk, got %v", remaining)
+	}
+
+	cached := manager.caches[app.ID].GetEventsSince(toMinutesSinceEpoch(now.Add(-time.Hour)))
+	if len(cached) != 1 || cached[0].EventID != "4" {
+		t.Errorf("Expected only event 4 in cache, got %+v", cached)
+	}
+
+	if !manager.IsErased(app.ID, &models.Event{User: models.UserInfo{AnonymousID: "a1"}}) {
+		t.Error("Expected later events of the erased user to be recognised")
+	}
+	if manager.IsErased(app.ID, &models.Event{User: models.UserInfo{ID: "u2"}}) {
+		t.Error("Expected other users not to be erased")
+	}
+	if summaries := manager.catalog.events(app.ID); len(summaries) != 1 || summaries[0].Properties["age"] == nil || len(summaries[0].Properties["age"].Samples) != 0 {
+		t.Errorf("Expected the age property kept without samples, got %+v", summaries)
+	}
+	if got, _ := manager.GetApp(app.ID); got.public().Tombstones != nil {
+		t.Error("Expected tombstones to be hidden from clients")
+	}
+}
+
+func TestErasureResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app-metadata.json")
+	events := store.NewFileStore(filepath.Join(dir, "data"))
+	defer events.Close()
+
+	manager, err := NewManager(path, events, config.AppsConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	app, _ := manager.CreateApp("erasure-app", nil, "alice", "")
+	now := time.Now().UTC()
+	for i, user := range []string{"u1", "u2"} {
+		events.Append(app.ID, &models.Event{EventID: strconv.Itoa(i), AppID: app.ID, Timestamp: now, User: models.UserInfo{ID: user}})
+	}
+
+	// The process stops after saving the job, before it deletes anything
+	pending := &PendingErasure{JobID: "job-1", Keys: Erasure{UserID: "u1"}.tombstoneKeys(), Fields: []string{"user_id"}, CreatedAt: now}
+	if err := manager.addErasure(app.ID, pending); err != nil {
+		t.Fatalf("Failed to add erasure: %v", err)
+	}
+	manager.Close()
+
+	manager, err = NewManager(path, events, config.AppsConfig{})
+	if err != nil {
+		t.Fatalf("Failed to reload manager: %v", err)
+	}
+	manager.Close() // waits for the resumed job
+
+	if job, exists := manager.erasures.get(app.ID, "job-1"); !exists || job.Status != ErasureDone || job.Deleted != 1 {
+		t.Errorf("Expected resumed job done with 1 event deleted, got %+v", job)
+	}
+	var remaining []string
+	events.Scan(app.ID, now.Add(-time.Hour), now.Add(time.Hour), func(event models.Event) error {
+		remaining = append(remaining, event.EventID)
+		return nil
+	})
+	if len(remaining) != 1 || remaining[0] != "1" {
+		t.Errorf("Expected only the event of u2 kept, got %v", remaining)
+	}
+
+	// The finished job is no longer pending
+	manager, err = NewManager(path, events, config.AppsConfig{})
+	if err != nil {
+		t.Fatalf("Failed to reload manager: %v", err)
+	}
+	defer manager.Close()
+	if got, _ := manager.GetApp(app.ID); len(got.PendingErasures) != 0 {
+		t.Errorf("Expected no pending erasures, got %+v", got.PendingErasures)
+	}
+}
@@ -110,6 +110,28 @@ func (c *EventCache) GetEventsSince(startMinutes int64) []models.Event {
 	return events
 }
 
+// Remove deletes the cached events for which match returns true and reports how many were removed.
+func (c *EventCache) Remove(match func(event *models.Event) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for i := range c.buckets {
+		kept := c.buckets[i][:0]
+		for j := range c.buckets[i] {
+			if match(&c.buckets[i][j]) {
+				removed++
+				continue
+			}
+			kept = append(kept, c.buckets[i][j])
+		}
+		// Clear the removed events left past the end of the bucket
+		clear(c.buckets[i][len(kept):])
+		c.buckets[i] = kept
+	}
+	return removed
+}
+
 // advance shifts the buffer every minute to evict old data.
 // It aligns to clock minute boundaries to avoid initial gap issues.
 func (c *EventCache) advance() {
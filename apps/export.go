@@ -0,0 +1,303 @@
+package apps
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"analytics/models"
+	"analytics/store"
+)
+
+// maxExportPasses bounds the scans of an app's history following the
+// identifiers of a subject. Each pass adds the identifiers found on the
+// events matched so far, so a chain of n sessions needs about n passes.
+const maxExportPasses = 5
+
+// Subject identifies the user of an access request. Events with the user ID
+// match, as do events without a user ID that have one of the anonymous or
+// session IDs. The anonymous and session IDs of matching events are followed
+// in turn, so that for example the anonymous events before a login are found
+// from the user ID. Events with another user ID never match, and anonymous IDs
+// the server derived from the client IP and user agent are not followed, as
+// everyone behind the same NAT with the same browser shares them.
+type Subject struct {
+	UserID      string `json:"user_id,omitempty"`
+	AnonymousID string `json:"anonymous_id,omitempty"`
+	SessionID   string `json:"session_id,omitempty"`
+}
+
+// Export is everything stored about a subject in one app.
+type Export struct {
+	Summary ExportSummary
+	Events  []models.Event // by timestamp
+}
+
+// ExportSummary describes the events of a subject.
+type ExportSummary struct {
+	AppID        string            `json:"app_id"`
+	GeneratedAt  time.Time         `json:"generated_at"`
+	UserIDs      []string          `json:"user_ids"`
+	AnonymousIDs []string          `json:"anonymous_ids"`
+	SessionIDs   []string          `json:"session_ids"`
+	Events       int               `json:"events"`
+	FirstSeen    *time.Time        `json:"first_seen,omitempty"`
+	LastSeen     *time.Time        `json:"last_seen,omitempty"`
+	Devices      []DeviceSummary   `json:"devices"`
+	Locations    []LocationSummary `json:"locations"`
+}
+
+// DeviceSummary counts the events of a subject sent from one device.
+type DeviceSummary struct {
+	models.DeviceInfo
+	Events    int       `json:"events"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// LocationSummary counts the events of a subject sent from one location.
+type LocationSummary struct {
+	models.LocationInfo
+	Events    int       `json:"events"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// subjectIDs is the set of identifiers followed for a subject.
+type subjectIDs struct {
+	users, anonymous, sessions map[string]bool
+}
+
+func newSubjectIDs(subject Subject) subjectIDs {
+	ids := subjectIDs{
+		users:     make(map[string]bool),
+		anonymous: make(map[string]bool),
+		sessions:  make(map[string]bool),
+	}
+	if subject.UserID != "" {
+		ids.users[subject.UserID] = true
+	}
+	ids.follow(models.UserInfo{AnonymousID: subject.AnonymousID, SessionID: subject.SessionID})
+	return ids
+}
+
+// matches reports whether an event of user belongs to the subject. An event
+// with a user ID only does if it is the subject's.
+func (s subjectIDs) matches(user models.UserInfo) bool {
+	if user.ID != "" {
+		return s.users[user.ID]
+	}
+	return s.anonymous[user.AnonymousID] || s.sessions[user.SessionID]
+}
+
+// follow adds the anonymous and session IDs of user and reports whether any
+// was new. User IDs and derived anonymous IDs are never added, so the export
+// cannot reach other users.
+func (s subjectIDs) follow(user models.UserInfo) bool {
+	if user.AnonymousIDDerived {
+		user.AnonymousID = ""
+	}
+	added := false
+	for _, id := range []struct {
+		set   map[string]bool
+		value string
+	}{
+		{s.anonymous, user.AnonymousID},
+		{s.sessions, user.SessionID},
+	} {
+		if id.value != "" && !id.set[id.value] {
+			id.set[id.value] = true
+			added = true
+		}
+	}
+	return added
+}
+
+// BuildExport scans the whole history of an app, bot events included, for the
+// events of a subject. It is used both by ExportsHandler and the export command.
+func BuildExport(events store.EventStore, appID string, subject Subject) (*Export, error) {
+	if subject.UserID == "" && subject.AnonymousID == "" && subject.SessionID == "" {
+		return nil, fmt.Errorf("user_id, anonymous_id or session_id is required")
+	}
+
+	// Events are stamped with client time corrected to within minutes of receipt
+	start, end := time.Time{}, time.Now().Add(24*time.Hour)
+	ids := newSubjectIDs(subject)
+	var matched []models.Event
+	for pass := 1; ; pass++ {
+		matched = matched[:0]
+		grew := false
+		collect := func(event models.Event) error {
+			if ids.matches(event.User) {
+				grew = ids.follow(event.User) || grew
+				matched = append(matched, event)
+			}
+			return nil
+		}
+		for _, storeID := range []string{appID, BotsStoreID(appID)} {
+			if err := events.Scan(storeID, start, end, collect); err != nil {
+				return nil, fmt.Errorf("scan events: %w", err)
+			}
+		}
+		if !grew {
+			break
+		}
+		if pass == maxExportPasses {
+			log.Printf("BuildExport: Stopped following identifiers for app %s after %d passes", appID, pass)
+			break
+		}
+	}
+	sortEvents(matched)
+
+	return &Export{
+		Summary: summarizeExport(appID, ids, matched),
+		Events:  matched,
+	}, nil
+}
+
+func summarizeExport(appID string, ids subjectIDs, events []models.Event) ExportSummary {
+	summary := ExportSummary{
+		AppID:        appID,
+		GeneratedAt:  time.Now().UTC(),
+		UserIDs:      sortedKeys(ids.users),
+		AnonymousIDs: sortedKeys(ids.anonymous),
+		SessionIDs:   sortedKeys(ids.sessions),
+		Events:       len(events),
+		Devices:      make([]DeviceSummary, 0),
+		Locations:    make([]LocationSummary, 0),
+	}
+	if len(events) == 0 {
+		return summary
+	}
+	first, last := events[0].Timestamp, events[len(events)-1].Timestamp
+	summary.FirstSeen, summary.LastSeen = &first, &last
+
+	devices := make(map[models.DeviceInfo]int)
+	locations := make(map[models.LocationInfo]int)
+	for _, event := range events {
+		i, exists := devices[event.Device]
+		if !exists {
+			i = len(summary.Devices)
+			devices[event.Device] = i
+			summary.Devices = append(summary.Devices, DeviceSummary{DeviceInfo: event.Device, FirstSeen: event.Timestamp})
+		}
+		summary.Devices[i].Events++
+		summary.Devices[i].LastSeen = event.Timestamp
+
+		if event.Location == nil || *event.Location == (models.LocationInfo{}) {
+			continue
+		}
+		j, exists := locations[*event.Location]
+		if !exists {
+			j = len(summary.Locations)
+			locations[*event.Location] = j
+			summary.Locations = append(summary.Locations, LocationSummary{LocationInfo: *event.Location, FirstSeen: event.Timestamp})
+		}
+		summary.Locations[j].Events++
+		summary.Locations[j].LastSeen = event.Timestamp
+	}
+	return summary
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteZip writes the export as a zip archive holding events.ndjson, one event
+// per line, and summary.json.
+func (e *Export) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	file, err := archive.CreateHeader(e.fileHeader("events.ndjson"))
+	if err != nil {
+		return fmt.Errorf("create events file: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	for i := range e.Events {
+		if err := encoder.Encode(&e.Events[i]); err != nil {
+			return fmt.Errorf("write event: %w", err)
+		}
+	}
+
+	file, err = archive.CreateHeader(e.fileHeader("summary.json"))
+	if err != nil {
+		return fmt.Errorf("create summary file: %w", err)
+	}
+	encoder = json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(e.Summary); err != nil {
+		return fmt.Errorf("write summary: %w", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return nil
+}
+
+func (e *Export) fileHeader(name string) *zip.FileHeader {
+	return &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: e.Summary.GeneratedAt}
+}
+
+func isExportsPath(path string) bool {
+	sub := appSubPath(path)
+	return sub == "exports" || sub == "exports/"
+}
+
+// ExportsHandler answers access requests for users of an app; CrudHandler has
+// already checked that the user is an admin.
+//   - POST /apps/<id>/exports: {"user_id", "anonymous_id", "session_id"}, any of
+//     them; responds with the zip archive of Export.WriteZip
+func (m *Manager) ExportsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("ExportsHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		appID, err := extractAppID(r.URL.Path)
+		if err != nil {
+			http.Error(w, "invalid app ID", http.StatusBadRequest)
+			return
+		}
+
+		var subject Subject
+		if err := json.NewDecoder(r.Body).Decode(&subject); err != nil {
+			log.Printf("ExportsHandler: Invalid request body: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if subject.UserID == "" && subject.AnonymousID == "" && subject.SessionID == "" {
+			http.Error(w, "user_id, anonymous_id or session_id is required", http.StatusBadRequest)
+			return
+		}
+
+		export, err := BuildExport(m.events, appID, subject)
+		if err != nil {
+			log.Printf("ExportsHandler: Failed to build export for app %s: %v", appID, err)
+			http.Error(w, "Failed to build export", http.StatusInternalServerError)
+			return
+		}
+
+		filename := fmt.Sprintf("export-%s-%s.zip", appID, export.Summary.GeneratedAt.Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		if err := export.WriteZip(w); err != nil {
+			// Headers are sent, so the client sees a truncated archive
+			log.Printf("ExportsHandler: Failed to write export for app %s: %v", appID, err)
+			return
+		}
+		log.Printf("ExportsHandler: Exported %d events for app %s", export.Summary.Events, appID)
+	}
+}
@@ -0,0 +1,174 @@
+package apps
+
+import (
+	"analytics/config"
+	"analytics/models"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildExportFollowsIdentifiers(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	app, _ := manager.CreateApp("export-app", nil, "alice", "")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	web := models.DeviceInfo{Platform: "web", Browser: "Firefox"}
+	ios := models.DeviceInfo{Platform: "ios"}
+	events := []models.Event{
+		// Browsing anonymously, then logging in within the same session
+		{EventID: "1", Timestamp: now.Add(-3 * time.Hour), User: models.UserInfo{AnonymousID: "a1", SessionID: "s1"}, Device: web, Location: &models.LocationInfo{Country: "FR"}},
+		{EventID: "2", Timestamp: now.Add(-2 * time.Hour), User: models.UserInfo{ID: "u1", SessionID: "s1"}, Device: web, Location: &models.LocationInfo{Country: "FR"}},
+		// Later, on another device
+		{EventID: "3", Timestamp: now.Add(-time.Hour), User: models.UserInfo{ID: "u1", SessionID: "s2"}, Device: ios},
+		{EventID: "4", Timestamp: now, User: models.UserInfo{ID: "u2", SessionID: "s3"}, Device: web},
+	}
+	for i := range events {
+		events[i].AppID = app.ID
+		manager.events.Append(app.ID, &events[i])
+	}
+
+	export, err := BuildExport(manager.events, app.ID, Subject{UserID: "u1"})
+	if err != nil {
+		t.Fatalf("Failed to build export: %v", err)
+	}
+
+	var ids []string
+	for _, event := range export.Events {
+		ids = append(ids, event.EventID)
+	}
+	if expected := []string{"1", "2", "3"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected events %v, got %v", expected, ids)
+	}
+
+	summary := export.Summary
+	if !reflect.DeepEqual(summary.AnonymousIDs, []string{"a1"}) || !reflect.DeepEqual(summary.SessionIDs, []string{"s1", "s2"}) {
+		t.Errorf("Expected identifiers a1 and s1, s2, got %v and %v", summary.AnonymousIDs, summary.SessionIDs)
+	}
+	if summary.FirstSeen == nil || !summary.FirstSeen.Equal(events[0].Timestamp) || !summary.LastSeen.Equal(events[2].Timestamp) {
+		t.Errorf("Expected seen from %v to %v, got %v to %v", events[0].Timestamp, events[2].Timestamp, summary.FirstSeen, summary.LastSeen)
+	}
+	if len(summary.Devices) != 2 || summary.Devices[0].DeviceInfo != web || summary.Devices[0].Events != 2 {
+		t.Errorf("Expected two devices with the web one used twice, got %+v", summary.Devices)
+	}
+	if len(summary.Locations) != 1 || summary.Locations[0].Country != "FR" || summary.Locations[0].Events != 2 {
+		t.Errorf("Expected one location used twice, got %+v", summary.Locations)
+	}
+
+	if _, err := BuildExport(manager.events, app.ID, Subject{}); err == nil {
+		t.Error("Expected an error without identifiers")
+	}
+}
+
+func TestBuildExportSharedAnonymousID(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	app, _ := manager.CreateApp("export-app", nil, "alice", "")
+
+	// Two users behind one NAT get the same cookieless anonymous ID
+	now := time.Now().UTC()
+	events := []models.Event{
+		{EventID: "1", Timestamp: now.Add(-4 * time.Hour), User: models.UserInfo{ID: "u1", AnonymousID: "nat"}},
+		{EventID: "2", Timestamp: now.Add(-3 * time.Hour), User: models.UserInfo{ID: "u2", AnonymousID: "nat", SessionID: "s2"}},
+		{EventID: "3", Timestamp: now.Add(-2 * time.Hour), User: models.UserInfo{AnonymousID: "nat"}},
+		{EventID: "4", Timestamp: now.Add(-time.Hour), User: models.UserInfo{SessionID: "s2"}},
+		{EventID: "5", Timestamp: now, User: models.UserInfo{ID: "u2"}},
+	}
+	for i := range events {
+		events[i].AppID = app.ID
+		manager.events.Append(app.ID, &events[i])
+	}
+
+	tests := []struct {
+		subject  Subject
+		expected []string
+	}{
+		{Subject{UserID: "u1"}, []string{"1", "3"}},
+		{Subject{AnonymousID: "nat"}, []string{"3"}},
+	}
+	for _, tt := range tests {
+		export, err := BuildExport(manager.events, app.ID, tt.subject)
+		if err != nil {
+			t.Fatalf("Failed to build export: %v", err)
+		}
+		var ids []string
+		for _, event := range export.Events {
+			ids = append(ids, event.EventID)
+		}
+		if !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("Export of %+v: expected events %v, got %v", tt.subject, tt.expected, ids)
+		}
+		if slices.Contains(export.Summary.UserIDs, "u2") || slices.Contains(export.Summary.SessionIDs, "s2") {
+			t.Errorf("Export of %+v: expected no identifiers of u2, got %+v", tt.subject, export.Summary)
+		}
+	}
+}
+
+func TestExportsHandler(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	org, _ := manager.CreateOrg("team", "alice")
+	manager.SetMember(org.ID, "bob", "", RoleViewer)
+	app, _ := manager.CreateApp("export-app", nil, "alice", org.ID)
+	manager.events.Append(app.ID, &models.Event{EventID: "1", AppID: app.ID, Timestamp: time.Now(), User: models.UserInfo{ID: "u1"}})
+	manager.events.Append(BotsStoreID(app.ID), &models.Event{EventID: "2", AppID: app.ID, Timestamp: time.Now(), User: models.UserInfo{ID: "u1"}, IsBot: true})
+
+	request := func(body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/apps/"+app.ID+"/exports", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		manager.CrudHandler()(w, withUser(req, user))
+		return w
+	}
+
+	if w := request(`{"user_id":"u1"}`, "bob"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for viewer, got %d", w.Code)
+	}
+	if w := request(`{}`, "alice"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without identifier, got %d", w.Code)
+	}
+
+	w := request(`{"user_id":"u1"}`, "alice")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected a zip archive, got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		rc, _ := file.Open()
+		var buf bytes.Buffer
+		buf.ReadFrom(rc)
+		rc.Close()
+		files[file.Name] = buf.Bytes()
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(bytes.NewReader(files["events.ndjson"]))
+	for scanner.Scan() {
+		var event models.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Errorf("Expected an event per line, got %q", scanner.Text())
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("Expected 2 events including the bot one, got %d", lines)
+	}
+
+	var summary ExportSummary
+	if err := json.Unmarshal(files["summary.json"], &summary); err != nil {
+		t.Fatalf("Failed to decode summary: %v", err)
+	}
+	if summary.AppID != app.ID || summary.Events != 2 {
+		t.Errorf("Expected summary of 2 events of %s, got %+v", app.ID, summary)
+	}
+}
@@ -0,0 +1,184 @@
+package apps
+
+import (
+	"analytics/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter operators, matching the Dart query engine's FilterOperator.
+const (
+	opEquals         = "="
+	opNotEquals      = "!="
+	opGreaterThan    = ">"
+	opGreaterOrEqual = ">="
+	opLessThan       = "<"
+	opLessOrEqual    = "<="
+	opContains       = "contains"
+)
+
+// eventFilter is one filter expression such as "event_type=click",
+// "device.platform!=web", "properties.plan contains pro" or "properties.amount>=10".
+// Field is a dotted path resolved with models.Event.Field.
+type eventFilter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// eventFilters matches events that satisfy every filter.
+type eventFilters []eventFilter
+
+func (fs eventFilters) matches(event *models.Event) bool {
+	for _, f := range fs {
+		if !f.matches(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseFilters parses the repeated "filter" query parameter.
+func parseFilters(exprs []string) (eventFilters, error) {
+	filters := make(eventFilters, 0, len(exprs))
+	for _, expr := range exprs {
+		f, err := parseFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+func parseFilter(expr string) (eventFilter, error) {
+	expr = strings.TrimSpace(expr)
+
+	end := 0
+	for end < len(expr) && isFieldChar(expr[end]) {
+		end++
+	}
+	field := expr[:end]
+	rest := strings.TrimLeft(expr[end:], " ")
+	if field == "" || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") {
+		return eventFilter{}, fmt.Errorf("invalid filter %q: missing field", expr)
+	}
+
+	var op string
+	switch {
+	case strings.HasPrefix(strings.ToLower(rest), opContains+" "):
+		op = opContains
+	case strings.HasPrefix(rest, opNotEquals):
+		op = opNotEquals
+	case strings.HasPrefix(rest, opGreaterOrEqual):
+		op = opGreaterOrEqual
+	case strings.HasPrefix(rest, opLessOrEqual):
+		op = opLessOrEqual
+	case strings.HasPrefix(rest, opEquals):
+		op = opEquals
+	case strings.HasPrefix(rest, opGreaterThan):
+		op = opGreaterThan
+	case strings.HasPrefix(rest, opLessThan):
+		op = opLessThan
+	default:
+		return eventFilter{}, fmt.Errorf("invalid filter %q: expected one of =, !=, >, >=, <, <=, contains", expr)
+	}
+
+	value := strings.TrimSpace(rest[len(op):])
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return eventFilter{Field: field, Op: op, Value: value}, nil
+}
+
+func isFieldChar(c byte) bool {
+	return c == '.' || c == '_' || c == '-' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// matches applies the filter to an event. As in the Dart Filter, an event
+// without the field never matches, whatever the operator.
+func (f eventFilter) matches(event *models.Event) bool {
+	fieldValue, ok := event.Field(f.Field)
+	if !ok {
+		return false
+	}
+
+	switch f.Op {
+	case opContains:
+		return strings.Contains(formatValue(fieldValue), f.Value)
+	case opEquals:
+		return compareValue(fieldValue, f.Value) == 0
+	case opNotEquals:
+		return compareValue(fieldValue, f.Value) != 0
+	case opGreaterThan:
+		return compareValue(fieldValue, f.Value) > 0
+	case opGreaterOrEqual:
+		return compareValue(fieldValue, f.Value) >= 0
+	case opLessThan:
+		return compareValue(fieldValue, f.Value) < 0
+	case opLessOrEqual:
+		return compareValue(fieldValue, f.Value) <= 0
+	}
+	return false
+}
+
+// compareValue compares a field value with a filter operand. Numbers and
+// times compare by value when the operand parses as one; everything else compares as text.
+func compareValue(fieldValue interface{}, operand string) int {
+	switch v := fieldValue.(type) {
+	case float64:
+		if n, err := strconv.ParseFloat(operand, 64); err == nil {
+			return compareFloat(v, n)
+		}
+	case int:
+		if n, err := strconv.ParseFloat(operand, 64); err == nil {
+			return compareFloat(float64(v), n)
+		}
+	case int64:
+		if n, err := strconv.ParseFloat(operand, 64); err == nil {
+			return compareFloat(float64(v), n)
+		}
+	case bool:
+		if b, err := strconv.ParseBool(operand); err == nil {
+			return compareFloat(boolToFloat(v), boolToFloat(b))
+		}
+	case time.Time:
+		if t, err := time.Parse(time.RFC3339Nano, operand); err == nil {
+			return v.Compare(t)
+		}
+	}
+	return strings.Compare(formatValue(fieldValue), operand)
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// formatValue renders a field value as text, the way it appears in event JSON.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
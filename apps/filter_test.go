@@ -0,0 +1,120 @@
+package apps
+
+import (
+	"analytics/models"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr        string
+		expect      eventFilter
+		expectError bool
+	}{
+		{expr: "event_type=click", expect: eventFilter{"event_type", opEquals, "click"}},
+		{expr: "device.platform!=web", expect: eventFilter{"device.platform", opNotEquals, "web"}},
+		{expr: "properties.plan contains pro", expect: eventFilter{"properties.plan", opContains, "pro"}},
+		{expr: "properties.amount >= 10", expect: eventFilter{"properties.amount", opGreaterOrEqual, "10"}},
+		{expr: "properties.amount<10", expect: eventFilter{"properties.amount", opLessThan, "10"}},
+		{expr: `event_name="sign up"`, expect: eventFilter{"event_name", opEquals, "sign up"}},
+		{expr: "=click", expectError: true},
+		{expr: "event_type click", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := parseFilter(tt.expr)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if f != tt.expect {
+				t.Errorf("Expected %+v, got %+v", tt.expect, f)
+			}
+		})
+	}
+}
+
+func TestEventFilterMatches(t *testing.T) {
+	event := &models.Event{
+		EventType: models.EventTypeClick,
+		Timestamp: time.Date(2025, 8, 24, 12, 0, 0, 0, time.UTC),
+		Device:    models.DeviceInfo{Platform: "ios", Locale: "en_GB"},
+		Properties: map[string]interface{}{
+			"plan":   "pro-annual",
+			"amount": 42.5,
+			"count":  0.0,
+			"trial":  true,
+			"nested": map[string]interface{}{"level": "gold"},
+		},
+	}
+
+	tests := []struct {
+		expr   string
+		expect bool
+	}{
+		{"event_type=click", true},
+		{"event_type=page_view", false},
+		{"device.platform!=web", true},
+		{"device.locale contains GB", true},
+		{"properties.plan contains pro", true},
+		{"properties.amount>40", true},
+		{"properties.amount<=42.5", true},
+		{"properties.amount<9", false},
+		{"properties.count=0", true},
+		{"properties.trial=true", true},
+		{"properties.nested.level=gold", true},
+		{"timestamp>=2025-08-24T00:00:00Z", true},
+		{"timestamp<2025-08-24T00:00:00Z", false},
+		// Bool struct fields are present when false
+		{"is_bot=false", true},
+		{"is_bot!=true", true},
+		{"is_bot=true", false},
+		// Missing fields never match, as in the Dart Filter
+		{"device.timezone!=UTC", false},
+		{"properties.missing!=x", false},
+		{"web_specific.page_url contains /", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := parseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := f.matches(event); got != tt.expect {
+				t.Errorf("Expected %v, got %v", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestGetEventsAppliesFilters(t *testing.T) {
+	baseTime := time.Now().UTC()
+	cache := NewEventCache()
+	defer cache.Stop()
+
+	cache.Add(&models.Event{EventID: "click1", EventType: models.EventTypeClick, Timestamp: baseTime})
+	cache.Add(&models.Event{EventID: "view1", EventType: models.EventTypePageView, Timestamp: baseTime})
+
+	manager := &Manager{caches: map[string]*EventCache{"test-app": cache}}
+	filters, _ := parseFilters([]string{"event_type=click"})
+
+	events, _, err := manager.getEvents(eventsQuery{
+		AppID:        "test-app",
+		StartMinutes: toMinutesSinceEpoch(baseTime.Add(-5 * time.Minute)),
+		Filters:      filters,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].EventID != "click1" {
+		t.Errorf("Expected only click1, got %v", events)
+	}
+}
@@ -77,7 +77,7 @@ func TestGetEventsFromCache(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			events, found := manager.getEventsFromCache(tt.appID, tt.startMinutes)
+			events, found := manager.getEventsFromCache(eventsQuery{AppID: tt.appID, StartMinutes: tt.startMinutes})
 
 			if found != tt.expectFound {
 				t.Errorf("Expected found=%t, got found=%t", tt.expectFound, found)
@@ -2,6 +2,7 @@ package apps
 
 import (
 	"analytics/models"
+	"analytics/store"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -9,11 +10,18 @@ import (
 	"time"
 )
 
+// newTestFileStore returns a FileStore over data/ in the working directory, closed when the test ends.
+func newTestFileStore(t *testing.T) store.EventStore {
+	events := store.NewFileStore(store.DefaultDataDir)
+	t.Cleanup(func() { events.Close() })
+	return events
+}
+
 func TestGetEventsFromDisk(t *testing.T) {
 	// Create temporary directory for test data
 	tempDir := t.TempDir()
 
-	manager := &Manager{}
+	manager := &Manager{events: newTestFileStore(t)}
 
 	// Create test events
 	baseTime := time.Date(2025, 8, 24, 12, 0, 0, 0, time.UTC)
@@ -79,7 +87,7 @@ func TestGetEventsFromDisk(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			events, err := manager.getEventsFromDisk(appID, tt.startMinutes)
+			events, err := manager.getEventsFromDisk(eventsQuery{AppID: appID, StartMinutes: tt.startMinutes})
 
 			if err != nil {
 				t.Errorf("Unexpected error: %v", err)
@@ -106,7 +114,7 @@ func TestGetEventsFromDisk(t *testing.T) {
 }
 
 func TestGetEventsFromDiskErrorCases(t *testing.T) {
-	manager := &Manager{}
+	manager := &Manager{events: newTestFileStore(t)}
 
 	tests := []struct {
 		name        string
@@ -149,7 +157,7 @@ func TestGetEventsFromDiskErrorCases(t *testing.T) {
 			defer os.Chdir(oldWd)
 
 			startMinutes := toMinutesSinceEpoch(time.Now().Add(-1 * time.Hour))
-			events, err := manager.getEventsFromDisk(tt.appID, startMinutes)
+			events, err := manager.getEventsFromDisk(eventsQuery{AppID: tt.appID, StartMinutes: startMinutes})
 
 			if tt.expectError && err == nil {
 				t.Errorf("Expected error but got none")
@@ -0,0 +1,181 @@
+package apps
+
+import (
+	"analytics/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Aggregation time buckets
+var aggregateBuckets = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// aggregateQuery is a parsed aggregation request: the events query plus grouping.
+type aggregateQuery struct {
+	eventsQuery
+	GroupBy string // dotted field path, "" for no grouping
+	Bucket  string // "minute", "hour", "day" or "" for no time bucketing
+}
+
+type aggregateKey struct {
+	bucket int64 // unix seconds of the bucket start
+	value  string
+	found  bool
+}
+
+// AggregateRow is the count of events in one time bucket with one group-by value.
+// Time is omitted without a bucket; Value is omitted without group-by and for
+// events that lack the group-by field.
+type AggregateRow struct {
+	Time  *time.Time `json:"time,omitempty"`
+	Value *string    `json:"value,omitempty"`
+	Count int        `json:"count"`
+}
+
+// AggregateResponse is the result of an aggregation request.
+type AggregateResponse struct {
+	GroupBy string         `json:"group_by,omitempty"`
+	Bucket  string         `json:"bucket,omitempty"`
+	Total   int            `json:"total"`
+	Results []AggregateRow `json:"results"`
+}
+
+// AggregateHandler counts events grouped by a field and time bucket.
+// It takes the same start, end and filter parameters as GetEventsHandler, plus:
+//   - group-by: dotted field path, e.g. device.locale or properties.page_url
+//   - bucket: minute, hour or day
+//
+// Counts are computed while scanning, so raw events never leave the server.
+func (m *Manager) AggregateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("AggregateHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q, err := m.parseAggregateRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := m.aggregate(q)
+		if err != nil {
+			log.Printf("AggregateHandler: Error aggregating events: %v", err)
+			http.Error(w, "Failed to aggregate events", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("AggregateHandler: Failed to encode response: %v", err)
+		}
+	}
+}
+
+func (m *Manager) parseAggregateRequest(r *http.Request) (aggregateQuery, error) {
+	eq, err := m.parseRequest(r)
+	if err != nil {
+		return aggregateQuery{}, err
+	}
+	// Aggregates cover the whole range
+	eq.Limit = 0
+	eq.Cursor = nil
+
+	q := aggregateQuery{
+		eventsQuery: eq,
+		GroupBy:     r.URL.Query().Get("group-by"),
+		Bucket:      r.URL.Query().Get("bucket"),
+	}
+	if q.Bucket != "" {
+		if _, ok := aggregateBuckets[q.Bucket]; !ok {
+			return aggregateQuery{}, fmt.Errorf("invalid bucket, expected minute, hour or day")
+		}
+	}
+	return q, nil
+}
+
+// aggregate counts the events matching q from the cache if it covers the range, else from the store.
+func (m *Manager) aggregate(q aggregateQuery) (*AggregateResponse, error) {
+	counts := make(map[aggregateKey]int)
+	total := 0
+	count := func(event models.Event) error {
+		if !q.matches(event) {
+			return nil
+		}
+		counts[q.key(&event)]++
+		total++
+		return nil
+	}
+
+	if events, found := m.getEventsFromCache(q.eventsQuery); found {
+		for _, event := range events {
+			count(event)
+		}
+	} else if err := m.events.Scan(q.AppID, q.startTime(), q.endTime(), count); err != nil {
+		return nil, err
+	}
+
+	results := make([]AggregateRow, 0, len(counts))
+	for key, n := range counts {
+		row := AggregateRow{Count: n}
+		if q.Bucket != "" {
+			bucketTime := time.Unix(key.bucket, 0).UTC()
+			row.Time = &bucketTime
+		}
+		if key.found {
+			value := key.value
+			row.Value = &value
+		}
+		results = append(results, row)
+	}
+	sortAggregateRows(results)
+
+	return &AggregateResponse{
+		GroupBy: q.GroupBy,
+		Bucket:  q.Bucket,
+		Total:   total,
+		Results: results,
+	}, nil
+}
+
+// key returns the bucket and group of an event.
+func (q aggregateQuery) key(event *models.Event) aggregateKey {
+	var key aggregateKey
+	if size, ok := aggregateBuckets[q.Bucket]; ok {
+		key.bucket = event.Timestamp.UTC().Truncate(size).Unix()
+	}
+	if q.GroupBy != "" {
+		if value, ok := event.Field(q.GroupBy); ok {
+			key.value = formatValue(value)
+			key.found = true
+		}
+	}
+	return key
+}
+
+// sortAggregateRows orders rows by time, then by count descending, then by value.
+func sortAggregateRows(rows []AggregateRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Time != nil && b.Time != nil && !a.Time.Equal(*b.Time) {
+			return a.Time.Before(*b.Time)
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Value == nil || b.Value == nil {
+			return b.Value == nil && a.Value != nil
+		}
+		return *a.Value < *b.Value
+	})
+}
@@ -0,0 +1,98 @@
+package apps
+
+import (
+	"analytics/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAggregateHandler(t *testing.T) {
+	tempDir := t.TempDir()
+	appID := "agg-app"
+	baseTime := time.Date(2025, 8, 24, 12, 0, 0, 0, time.UTC)
+
+	events := []models.Event{
+		{EventID: "e1", Timestamp: baseTime.Add(5 * time.Minute), EventType: models.EventTypePageView, Device: models.DeviceInfo{Locale: "en_GB"}},
+		{EventID: "e2", Timestamp: baseTime.Add(10 * time.Minute), EventType: models.EventTypePageView, Device: models.DeviceInfo{Locale: "en_GB"}},
+		{EventID: "e3", Timestamp: baseTime.Add(20 * time.Minute), EventType: models.EventTypePageView, Device: models.DeviceInfo{Locale: "de_DE"}},
+		{EventID: "e4", Timestamp: baseTime.Add(70 * time.Minute), EventType: models.EventTypePageView, Device: models.DeviceInfo{Locale: "en_GB"}},
+		{EventID: "e5", Timestamp: baseTime.Add(75 * time.Minute), EventType: models.EventTypePageView},
+		{EventID: "e6", Timestamp: baseTime.Add(80 * time.Minute), EventType: models.EventTypeClick, Device: models.DeviceInfo{Locale: "en_GB"}},
+	}
+	dirPath := filepath.Join(tempDir, "data", appID, baseTime.Format("20060102"))
+	os.MkdirAll(dirPath, 0755)
+	for _, event := range events {
+		data, _ := json.Marshal(event)
+		os.WriteFile(filepath.Join(dirPath, event.EventID+".json"), data, 0644)
+	}
+
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	manager := &Manager{events: newTestFileStore(t), caches: make(map[string]*EventCache)}
+
+	req := httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps/"+appID+"/aggregate", nil)
+	q := req.URL.Query()
+	q.Set("start-minutes-since-epoch", strconv.FormatInt(toMinutesSinceEpoch(baseTime), 10))
+	q.Set("end-minutes-since-epoch", strconv.FormatInt(toMinutesSinceEpoch(baseTime.Add(2*time.Hour)), 10))
+	q.Set("group-by", "device.locale")
+	q.Set("bucket", "hour")
+	q.Add("filter", "event_type=page_view")
+	req.URL.RawQuery = q.Encode()
+	w := httptest.NewRecorder()
+
+	manager.AggregateHandler()(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp AggregateResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Total != 5 {
+		t.Errorf("Expected total 5, got %d", resp.Total)
+	}
+
+	type row struct {
+		hour  int
+		value string
+		count int
+	}
+	expected := []row{
+		{12, "en_GB", 2},
+		{12, "de_DE", 1},
+		{13, "en_GB", 1},
+		{13, "", 1}, // event without a locale
+	}
+	if len(resp.Results) != len(expected) {
+		t.Fatalf("Expected %d rows, got %d: %+v", len(expected), len(resp.Results), resp.Results)
+	}
+	for i, exp := range expected {
+		got := resp.Results[i]
+		value := ""
+		if got.Value != nil {
+			value = *got.Value
+		}
+		if got.Time == nil || got.Time.Hour() != exp.hour || value != exp.value || got.Count != exp.count {
+			t.Errorf("Row %d: expected %+v, got time=%v value=%q count=%d", i, exp, got.Time, value, got.Count)
+		}
+	}
+}
+
+func TestParseAggregateRequestRejectsUnknownBucket(t *testing.T) {
+	manager := &Manager{}
+	req := httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps/test123/aggregate?bucket=week", nil)
+
+	if _, err := manager.parseAggregateRequest(req); err == nil {
+		t.Errorf("Expected error for unknown bucket")
+	}
+}
@@ -6,13 +6,79 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	// MaxEventsLimit caps the page size a client can request.
+	MaxEventsLimit = 10000
+
+	// NextCursorHeader carries the continuation cursor when more events are available.
+	NextCursorHeader = "X-Next-Cursor"
+
+	// maxDiskWindow bounds how far a paginated disk scan widens its window over empty days.
+	maxDiskWindow = 32 * 24 * time.Hour
+)
+
+// eventsQuery is a parsed events request. Times are minutes since epoch;
+// EndMinutes is exclusive and 0 means no upper bound. Limit 0 means no limit.
+type eventsQuery struct {
+	AppID        string
+	StartMinutes int64
+	EndMinutes   int64
+	Limit        int
+	Cursor       *eventCursor
+	Filters      eventFilters
+}
+
+// startTime returns where the query resumes: its start, or the cursor position if later.
+func (q eventsQuery) startTime() time.Time {
+	start := fromMinutesSinceEpoch(q.StartMinutes)
+	if q.Cursor != nil && q.Cursor.time().After(start) {
+		return q.Cursor.time()
+	}
+	return start
+}
+
+// endTime returns the exclusive upper bound of the query. Without an end
+// it covers the rest of the current day, as events may be slightly ahead of server time.
+func (q eventsQuery) endTime() time.Time {
+	if q.EndMinutes != 0 {
+		return fromMinutesSinceEpoch(q.EndMinutes)
+	}
+	return time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// matches reports whether an event falls in the query range, after its cursor, and passes its filters.
+func (q eventsQuery) matches(event models.Event) bool {
+	eventMinutes := toMinutesSinceEpoch(event.Timestamp)
+	if eventMinutes < q.StartMinutes {
+		return false
+	}
+	if q.EndMinutes != 0 && eventMinutes >= q.EndMinutes {
+		return false
+	}
+	if q.Cursor != nil && !q.Cursor.after(event) {
+		return false
+	}
+	return q.Filters.matches(&event)
+}
+
+// GetEventsHandler returns events of an app as a JSON array ordered by timestamp.
+// Query parameters:
+//   - start-minutes-since-epoch: inclusive start (default: last 30 minutes)
+//   - end-minutes-since-epoch: exclusive end (default: end of the current UTC day,
+//     so events slightly ahead of server time are included)
+//   - limit: maximum number of events in the response
+//   - cursor: continuation token from a previous response's X-Next-Cursor header
+//   - filter: repeatable field filter, e.g. filter=event_type=click or
+//     filter=properties.plan contains pro (operators =, !=, >, >=, <, <=, contains)
+//   - bots: "true" returns the bot events kept apart under the separate bot policy
+//
+// When more events are available, the X-Next-Cursor response header holds the
+// cursor for the next page; it is absent on the last page.
 func (m *Manager) GetEventsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("GetEventsHandler: Received %s request for %s", r.Method, r.URL.Path)
@@ -22,72 +88,128 @@ func (m *Manager) GetEventsHandler() http.HandlerFunc {
 			return
 		}
 
-		appID, startMinutes, err := m.parseRequest(r)
+		q, err := m.parseRequest(r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		events, err := m.getEvents(appID, startMinutes)
+		events, nextCursor, err := m.getEvents(q)
 		if err != nil {
 			log.Printf("GetEventsHandler: Error getting events: %v", err)
 			http.Error(w, "Failed to get events", http.StatusInternalServerError)
 			return
 		}
 
-		m.sendResponse(w, events, appID)
+		if nextCursor != "" {
+			w.Header().Set(NextCursorHeader, nextCursor)
+		}
+		m.sendResponse(w, events, q.AppID)
 	}
 }
 
-func (m *Manager) parseRequest(r *http.Request) (string, int64, error) {
+func (m *Manager) parseRequest(r *http.Request) (eventsQuery, error) {
 	appID, err := extractAppID(r.URL.Path)
 	if err != nil {
-		return "", 0, fmt.Errorf("invalid app ID")
+		return eventsQuery{}, fmt.Errorf("invalid app ID")
 	}
 
-	// Default: last 30 minutes
-	startMinutes := toMinutesSinceEpoch(time.Now().UTC()) - CacheWindowMinutes
+	q := eventsQuery{
+		AppID: appID,
+		// Default: last 30 minutes
+		StartMinutes: toMinutesSinceEpoch(time.Now().UTC()) - CacheWindowMinutes,
+	}
+	query := r.URL.Query()
 
-	if startStr := r.URL.Query().Get("start-minutes-since-epoch"); startStr != "" {
+	if startStr := query.Get("start-minutes-since-epoch"); startStr != "" {
 		parsed, err := strconv.ParseInt(startStr, 10, 64)
 		if err != nil {
-			return "", 0, fmt.Errorf("invalid start-minutes-since-epoch format")
+			return eventsQuery{}, fmt.Errorf("invalid start-minutes-since-epoch format")
 		}
-		startMinutes = parsed
+		q.StartMinutes = parsed
 		// log.Printf("GetEventsHandler: Parsed start minutes: %d (%s)",
 		// 	startMinutes, fromMinutesSinceEpoch(startMinutes).Format(time.RFC3339))
 	}
 
-	return appID, startMinutes, nil
+	if endStr := query.Get("end-minutes-since-epoch"); endStr != "" {
+		parsed, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			return eventsQuery{}, fmt.Errorf("invalid end-minutes-since-epoch format")
+		}
+		if parsed <= q.StartMinutes {
+			return eventsQuery{}, fmt.Errorf("end-minutes-since-epoch must be after start-minutes-since-epoch")
+		}
+		q.EndMinutes = parsed
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			return eventsQuery{}, fmt.Errorf("invalid limit format")
+		}
+		if parsed > MaxEventsLimit {
+			return eventsQuery{}, fmt.Errorf("limit must not exceed %d", MaxEventsLimit)
+		}
+		q.Limit = parsed
+	}
+
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		q.Cursor, err = decodeCursor(cursorStr)
+		if err != nil {
+			return eventsQuery{}, err
+		}
+	}
+
+	q.Filters, err = parseFilters(query["filter"])
+	if err != nil {
+		return eventsQuery{}, err
+	}
+
+	// Separated bot events are never cached, so they are read from disk
+	if query.Get("bots") == "true" {
+		q.AppID = BotsStoreID(appID)
+	}
+
+	return q, nil
 }
 
-func (m *Manager) getEvents(appID string, startMinutes int64) ([]models.Event, error) {
+// getEvents returns one page of events matching q, in timestamp order,
+// and the cursor of the next page ("" on the last page).
+func (m *Manager) getEvents(q eventsQuery) ([]models.Event, string, error) {
 	// log.Printf("GetEventsHandler: Looking for events since minute %d (%s)",
 	// 	startMinutes, fromMinutesSinceEpoch(startMinutes).Format(time.RFC3339))
 
 	// Try cache first
-	if events, found := m.getEventsFromCache(appID, startMinutes); found {
-		return events, nil
+	events, found := m.getEventsFromCache(q)
+	if !found {
+		// Fallback to disk
+		var err error
+		events, err = m.getEventsFromDisk(q)
+		if err != nil {
+			return nil, "", err
+		}
 	}
 
-	// Fallback to disk
-	return m.getEventsFromDisk(appID, startMinutes)
+	events, nextCursor := paginate(events, q.Limit)
+	return events, nextCursor, nil
 }
 
-func (m *Manager) getEventsFromCache(appID string, startMinutes int64) ([]models.Event, bool) {
+// getEventsFromCache returns the sorted events matching q if the cache covers its start.
+func (m *Manager) getEventsFromCache(q eventsQuery) ([]models.Event, bool) {
 	m.cachesMu.RLock()
-	cache, exists := m.caches[appID]
+	cache, exists := m.caches[q.AppID]
 	m.cachesMu.RUnlock()
 
 	if !exists {
 		return nil, false
 	}
 
-	cache.mu.RLock()
-	defer cache.mu.RUnlock()
+	startMinutes := toMinutesSinceEpoch(q.startTime())
 
+	cache.mu.RLock()
 	// Check if startMinutes is within cache window using cache's lastMinute
 	cacheLastMinutes := toMinutesSinceEpoch(cache.lastMinute)
+	cache.mu.RUnlock()
 	cacheWindowStart := cacheLastMinutes - (CacheWindowMinutes - 1)
 
 	// Cache miss if request is older than cache window
@@ -104,87 +226,74 @@ func (m *Manager) getEventsFromCache(appID string, startMinutes int64) ([]models
 	}
 
 	// Let the cache handle its own iteration logic
-	events := cache.GetEventsSince(startMinutes)
+	cached := cache.GetEventsSince(startMinutes)
+
+	// Initialize as empty slice (not nil) so JSON encodes as [] not null
+	events := make([]models.Event, 0, len(cached))
+	for _, event := range cached {
+		if q.matches(event) {
+			events = append(events, event)
+		}
+	}
+	sortEvents(events)
 
 	log.Printf("GetEventsHandler: Retrieved %d events from cache", len(events))
 	return events, true
 }
 
-func (m *Manager) getEventsFromDisk(appID string, startMinutes int64) ([]models.Event, error) {
-	startTime := fromMinutesSinceEpoch(startMinutes)
+// getEventsFromDisk returns the sorted events matching q from the event store.
+// With a limit it scans day-sized windows in order and stops once more than
+// Limit events are collected, so a long range is never loaded whole; callers paginate the result.
+func (m *Manager) getEventsFromDisk(q eventsQuery) ([]models.Event, error) {
+	startTime := q.startTime()
+	endTime := q.endTime()
 	// log.Printf("GetEventsHandler: Scanning disk for events since minute %d (%s)",
 	// 	startMinutes, startTime.Format(time.RFC3339))
 
 	// Initialize as empty slice (not nil) so JSON encodes as [] not null
 	events := make([]models.Event, 0)
-	startDate := startTime.Truncate(24 * time.Hour)
-	endDate := time.Now().UTC().Truncate(24 * time.Hour)
-
-	for date := startDate; !date.After(endDate); date = date.Add(24 * time.Hour) {
-		dayEvents, err := m.getEventsFromDay(appID, date, startMinutes)
-		if err != nil {
-			return nil, err
+	collect := func(event models.Event) error {
+		if q.matches(event) {
+			events = append(events, event)
 		}
-		events = append(events, dayEvents...)
-	}
-
-	// log.Printf("GetEventsHandler: Retrieved %d events from disk", len(events))
-	return events, nil
-}
-
-func (m *Manager) getEventsFromDay(appID string, date time.Time, startMinutes int64) ([]models.Event, error) {
-	dir := filepath.Join("data", appID, date.Format("20060102"))
-	files, err := os.ReadDir(dir)
-	if os.IsNotExist(err) {
-		// log.Printf("GetEventsHandler: Directory %s does not exist", dir)
-		return []models.Event{}, nil
+		return nil
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory %s: %v", dir, err)
-	}
-
-	// log.Printf("GetEventsHandler: Found %d files in %s", len(files), dir)
 
-	if len(files) > 10000 {
-		return nil, fmt.Errorf("too many files in %s, please narrow time range", dir)
+	if q.Limit == 0 {
+		if err := m.events.Scan(q.AppID, startTime, endTime, collect); err != nil {
+			return nil, err
+		}
+		sortEvents(events)
+		return events, nil
 	}
 
-	// Initialize as empty slice (not nil) so JSON encodes as [] not null
-	events := make([]models.Event, 0)
-	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), ".json") {
-			continue
+	// Windows are sorted on their own and appended in order. Empty windows
+	// double in size so sparse history does not cost one scan per day.
+	window := 24 * time.Hour
+	for from := startTime; from.Before(endTime) && len(events) <= q.Limit; {
+		to := from.Add(window)
+		if to.After(endTime) {
+			to = endTime
 		}
 
-		event, err := m.readEventFile(filepath.Join(dir, file.Name()))
-		if err != nil {
-			log.Printf("GetEventsHandler: Failed to read event %s: %v", file.Name(), err)
-			continue
+		before := len(events)
+		if err := m.events.Scan(q.AppID, from, to, collect); err != nil {
+			return nil, err
 		}
+		sortEvents(events[before:])
 
-		eventMinutes := toMinutesSinceEpoch(event.Timestamp)
-		if eventMinutes >= startMinutes {
-			events = append(events, event)
+		if len(events) == before && window < maxDiskWindow {
+			window *= 2
+		} else if len(events) > before {
+			window = 24 * time.Hour
 		}
+		from = to
 	}
 
+	// log.Printf("GetEventsHandler: Retrieved %d events from disk", len(events))
 	return events, nil
 }
 
-func (m *Manager) readEventFile(filePath string) (models.Event, error) {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return models.Event{}, err
-	}
-
-	var event models.Event
-	if err := json.Unmarshal(data, &event); err != nil {
-		return models.Event{}, err
-	}
-
-	return event, nil
-}
-
 func (m *Manager) sendResponse(w http.ResponseWriter, events []models.Event, appID string) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(events); err != nil {
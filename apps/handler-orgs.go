@@ -0,0 +1,187 @@
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const orgsPrefix = "/analytics/api/v1/orgs/"
+
+// OrgsHandler lists the orgs of the signed-in user (GET) or creates an org owned by them (POST).
+func (m *Manager) OrgsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("OrgsHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		user, ok := identityFromContext(r)
+		if !ok {
+			log.Println("OrgsHandler: Missing user ID in context")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, "OrgsHandler", http.StatusOK, m.ListOrgs(user))
+		case http.MethodPost:
+			var req struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				log.Printf("OrgsHandler: Invalid request body: %v", err)
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if req.Name == "" {
+				http.Error(w, "Name is required", http.StatusBadRequest)
+				return
+			}
+
+			org, err := m.CreateOrg(req.Name, user.UserID)
+			if err != nil {
+				log.Printf("OrgsHandler: Failed to create org: %v", err)
+				http.Error(w, fmt.Sprintf("Failed to create org: %v", err), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, "OrgsHandler", http.StatusCreated, org)
+			log.Printf("OrgsHandler: Created org %s for user %s", org.ID, user.UserID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// OrgCrudHandler manages one org:
+//   - GET /orgs/<id>: the org and its members (viewer)
+//   - POST /orgs/<id>/members: add a member by user_id or email, or change their role (admin)
+//   - DELETE /orgs/<id>/members/<user_id or email>: remove a member (admin, or the member themselves)
+//
+// Only owners can grant or take away the owner role, and an org always keeps one owner.
+func (m *Manager) OrgCrudHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("OrgCrudHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		user, ok := identityFromContext(r)
+		if !ok {
+			log.Println("OrgCrudHandler: Missing user ID in context")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		orgID, rest, err := splitOrgPath(r.URL.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		org, exists := m.GetOrg(orgID)
+		if !exists {
+			http.Error(w, "Org not found", http.StatusNotFound)
+			return
+		}
+		role := Role("")
+		if member := org.member(user); member != nil {
+			role = member.Role
+		}
+		if role == "" {
+			log.Printf("OrgCrudHandler: User %s is not a member of org %s", user.UserID, orgID)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && rest == "":
+			writeJSON(w, "OrgCrudHandler", http.StatusOK, org)
+
+		case r.Method == http.MethodPost && rest == "members":
+			var req struct {
+				UserID string `json:"user_id"`
+				Email  string `json:"email"`
+				Role   Role   `json:"role"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				log.Printf("OrgCrudHandler: Invalid request body: %v", err)
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			existing := org.member(identity{UserID: req.UserID, Email: req.Email})
+			if !canManage(role, req.Role) || existing != nil && !canManage(role, existing.Role) {
+				log.Printf("OrgCrudHandler: User %s with role %q cannot grant %q in org %s", user.UserID, role, req.Role, orgID)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			member, err := m.SetMember(orgID, req.UserID, req.Email, req.Role)
+			if err != nil {
+				log.Printf("OrgCrudHandler: Failed to set member: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, "OrgCrudHandler", http.StatusOK, member)
+			log.Printf("OrgCrudHandler: Set role %s for %s%s in org %s", member.Role, member.UserID, member.Email, orgID)
+
+		case r.Method == http.MethodDelete && strings.HasPrefix(rest, "members/"):
+			target, err := url.PathUnescape(strings.TrimPrefix(rest, "members/"))
+			if err != nil || target == "" {
+				http.Error(w, "Invalid member", http.StatusBadRequest)
+				return
+			}
+			existing := org.member(identity{UserID: target, Email: target})
+			if existing == nil {
+				http.Error(w, "Member not found", http.StatusNotFound)
+				return
+			}
+			self := existing == org.member(user)
+			if !self && !canManage(role, existing.Role) {
+				log.Printf("OrgCrudHandler: User %s with role %q cannot remove %s from org %s", user.UserID, role, target, orgID)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			if err := m.RemoveMember(orgID, target); err != nil {
+				log.Printf("OrgCrudHandler: Failed to remove member: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			log.Printf("OrgCrudHandler: Removed %s from org %s", target, orgID)
+
+		default:
+			http.Error(w, "Invalid path or method", http.StatusBadRequest)
+		}
+	}
+}
+
+// canManage reports whether a member with role actor can grant or take away role target.
+func canManage(actor, target Role) bool {
+	if target == RoleOwner {
+		return actor == RoleOwner
+	}
+	return actor.Allows(RoleAdmin)
+}
+
+// splitOrgPath splits /analytics/api/v1/orgs/<id>/<rest> into the org ID and rest.
+func splitOrgPath(path string) (string, string, error) {
+	if !strings.HasPrefix(path, orgsPrefix) {
+		return "", "", fmt.Errorf("invalid path")
+	}
+	parts := strings.SplitN(strings.TrimPrefix(path, orgsPrefix), "/", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("missing org ID")
+	}
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	return parts[0], strings.TrimSuffix(parts[1], "/"), nil
+}
+
+func writeJSON(w http.ResponseWriter, handlerName string, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("%s: Failed to encode response: %v", handlerName, err)
+	}
+}
@@ -0,0 +1,154 @@
+package apps
+
+import (
+	"analytics/config"
+	fba "analytics/firebase_auth"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withEmail returns r with the verified email FirebaseAuthMiddleware would add.
+func withEmail(r *http.Request, email string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), fba.EmailKey, email))
+}
+
+func TestOrgRoles(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	org, err := manager.CreateOrg("team", "alice")
+	if err != nil {
+		t.Fatalf("Failed to create org: %v", err)
+	}
+	app, err := manager.CreateApp("team-app", nil, "alice", org.ID)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+
+	setMember := func(actor, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/orgs/"+org.ID+"/members", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		manager.OrgCrudHandler()(w, withUser(req, actor))
+		return w.Code
+	}
+	if code := setMember("alice", `{"user_id":"bob","role":"admin"}`); code != http.StatusOK {
+		t.Fatalf("Expected owner to add admin, got %d", code)
+	}
+	if code := setMember("alice", `{"email":"pm@example.com","role":"viewer"}`); code != http.StatusOK {
+		t.Fatalf("Expected owner to invite viewer, got %d", code)
+	}
+	if code := setMember("bob", `{"user_id":"carol","role":"owner"}`); code != http.StatusForbidden {
+		t.Errorf("Expected admin granting owner to be forbidden, got %d", code)
+	}
+	if code := setMember("bob", `{"user_id":"alice","role":"viewer"}`); code != http.StatusForbidden {
+		t.Errorf("Expected admin demoting owner to be forbidden, got %d", code)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		user           string
+		email          string
+		expectedStatus int
+	}{
+		{"invited viewer reads events", http.MethodGet, "", "pm-uid", "pm@example.com", http.StatusOK},
+		{"invited viewer changes origins", http.MethodPut, `{"name":"team-app","allowed_origins":["https://x"]}`, "pm-uid", "pm@example.com", http.StatusForbidden},
+		{"unverified email", http.MethodGet, "", "pm-uid", "", http.StatusForbidden},
+		{"admin changes origins", http.MethodPut, `{"name":"team-app","allowed_origins":["https://x"]}`, "bob", "", http.StatusOK},
+		{"admin deletes app", http.MethodDelete, "", "bob", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/analytics/api/v1/apps/" + app.ID
+			if tt.method == http.MethodGet {
+				path += "/events"
+			}
+			req := withUser(httptest.NewRequest(tt.method, path, strings.NewReader(tt.body)), tt.user)
+			if tt.email != "" {
+				req = withEmail(req, tt.email)
+			}
+			w := httptest.NewRecorder()
+			manager.CrudHandler()(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// The invited viewer sees the app in their list
+	req := withEmail(withUser(httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps", nil), "pm-uid"), "pm@example.com")
+	w := httptest.NewRecorder()
+	manager.ListAppsHandler()(w, req)
+	var apps []App
+	json.NewDecoder(w.Body).Decode(&apps)
+	if len(apps) != 1 || apps[0].ID != app.ID {
+		t.Errorf("Expected viewer to list %s, got %+v", app.ID, apps)
+	}
+}
+
+func TestOrgKeepsOneOwner(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	org, _ := manager.CreateOrg("team", "alice")
+
+	req := withUser(httptest.NewRequest(http.MethodDelete, "/analytics/api/v1/orgs/"+org.ID+"/members/alice", nil), "alice")
+	w := httptest.NewRecorder()
+	manager.OrgCrudHandler()(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 removing the last owner, got %d", w.Code)
+	}
+	if got, _ := manager.GetOrg(org.ID); len(got.Members) != 1 {
+		t.Errorf("Expected owner to remain, got %+v", got.Members)
+	}
+}
+
+func TestSetMemberRollsBackOnSaveFailure(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	org, _ := manager.CreateOrg("team", "alice")
+	manager.SetMember(org.ID, "bob", "", RoleViewer)
+
+	// A directory cannot be written as the metadata file
+	path := manager.path
+	manager.path = t.TempDir()
+	if _, err := manager.SetMember(org.ID, "carol", "", RoleAdmin); err == nil {
+		t.Fatal("Expected an error when saving fails")
+	}
+	if _, err := manager.SetMember(org.ID, "bob", "", RoleAdmin); err == nil {
+		t.Fatal("Expected an error when saving fails")
+	}
+	manager.path = path
+
+	got, _ := manager.GetOrg(org.ID)
+	if len(got.Members) != 2 {
+		t.Errorf("Expected the new member to be rolled back, got %+v", got.Members)
+	}
+	if member := got.member(identity{UserID: "bob"}); member == nil || member.Role != RoleViewer {
+		t.Errorf("Expected bob to stay a viewer, got %+v", member)
+	}
+}
+
+func TestMigrateOrgsMovesAppsIntoPersonalOrg(t *testing.T) {
+	manager := &Manager{data: &Data{
+		Apps: map[string]*App{"a1": {ID: "a1", OwnerID: "alice"}, "a2": {ID: "a2", OwnerID: "alice"}},
+		Orgs: make(map[string]*Org),
+	}}
+
+	if n := manager.migrateOrgs(); n != 2 {
+		t.Errorf("Expected 2 apps migrated, got %d", n)
+	}
+	org, exists := manager.data.Orgs[personalOrgID("alice")]
+	if !exists || len(manager.data.Orgs) != 1 {
+		t.Fatalf("Expected one personal org, got %+v", manager.data.Orgs)
+	}
+	if org.member(identity{UserID: "alice"}).Role != RoleOwner {
+		t.Errorf("Expected alice to own her personal org")
+	}
+	if manager.data.Apps["a1"].OrgID != org.ID {
+		t.Errorf("Expected app in personal org, got %q", manager.data.Apps["a1"].OrgID)
+	}
+}
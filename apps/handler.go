@@ -1,7 +1,9 @@
 package apps
 
 import (
+	fba "analytics/firebase_auth"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +12,36 @@ import (
 
 func (m *Manager) CrudHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Everything but creation acts on an existing app, with a role depending on the method
+		isKeys := isKeysPath(r.URL.Path)
+		isDefinitions := isDefinitionsPath(r.URL.Path)
+		isErasures := isErasuresPath(r.URL.Path)
+		isExports := isExportsPath(r.URL.Path)
+		if required, ok := crudRoles[r.Method]; ok || isKeys || isDefinitions || isErasures || isExports {
+			if isKeys || isErasures || isExports || isDefinitions && r.Method != http.MethodGet {
+				required = RoleAdmin
+			}
+			if _, ok := m.authorizeApp(w, r, "CrudHandler", required); !ok {
+				return
+			}
+		}
+		if isKeys {
+			m.KeysHandler()(w, r)
+			return
+		}
+		if isDefinitions {
+			m.EventDefinitionsHandler()(w, r)
+			return
+		}
+		if isErasures {
+			m.ErasuresHandler()(w, r)
+			return
+		}
+		if isExports {
+			m.ExportsHandler()(w, r)
+			return
+		}
+
 		switch r.Method {
 		case http.MethodPost:
 			m.CreateAppHandler()(w, r)
@@ -18,8 +50,18 @@ func (m *Manager) CrudHandler() http.HandlerFunc {
 		case http.MethodDelete:
 			m.DeleteAppHandler()(w, r)
 		case http.MethodGet:
-			if strings.HasSuffix(r.URL.Path, "/events") {
+			if strings.HasSuffix(r.URL.Path, "/events/stream") {
+				m.StreamEventsHandler()(w, r)
+			} else if strings.HasSuffix(r.URL.Path, "/events") {
 				m.GetEventsHandler()(w, r)
+			} else if strings.HasSuffix(r.URL.Path, "/aggregate") {
+				m.AggregateHandler()(w, r)
+			} else if strings.HasSuffix(r.URL.Path, "/usage") {
+				m.UsageHandler()(w, r)
+			} else if strings.HasSuffix(r.URL.Path, "/schema") {
+				m.CatalogHandler()(w, r)
+			} else if strings.HasSuffix(r.URL.Path, "/schema-violations") {
+				m.SchemaViolationsHandler()(w, r)
 			} else {
 				log.Printf("Main: Invalid GET path %s", r.URL.Path)
 				http.Error(w, "Invalid path", http.StatusBadRequest)
@@ -31,7 +73,65 @@ func (m *Manager) CrudHandler() http.HandlerFunc {
 	}
 }
 
-// ListAppsHandler returns all apps.
+// crudRoles is the org role CrudHandler requires for each method on an existing app.
+// Key management, erasures and exports need RoleAdmin whatever the method, as do changes to event definitions.
+var crudRoles = map[string]Role{
+	http.MethodGet:    RoleViewer,
+	http.MethodPut:    RoleAdmin,
+	http.MethodDelete: RoleOwner,
+}
+
+// identityFromContext returns the Firebase user set by FirebaseAuthMiddleware.
+func identityFromContext(r *http.Request) (identity, bool) {
+	userID, ok := r.Context().Value(fba.UserIDKey).(string)
+	email, _ := r.Context().Value(fba.EmailKey).(string)
+	return identity{UserID: userID, Email: email}, ok && userID != ""
+}
+
+// authorizeApp checks that the app in the request path exists and that the
+// signed-in user has at least the required role in its org, or that the
+// request's API key has the matching scope, writing the error response if not.
+func (m *Manager) authorizeApp(w http.ResponseWriter, r *http.Request, handlerName string, required Role) (*App, bool) {
+	if auth, ok := r.Context().Value(keyAuthContextKey).(keyAuth); ok {
+		return m.authorizeKey(w, r, handlerName, auth, required)
+	}
+
+	user, ok := identityFromContext(r)
+	if !ok {
+		log.Printf("%s: Missing user ID in context", handlerName)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	appID, err := extractAppID(r.URL.Path)
+	if err != nil {
+		http.Error(w, "invalid app ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	m.dataMu.RLock()
+	app, exists := m.data.Apps[appID]
+	var role Role
+	if exists {
+		role = m.roleFor(user, app)
+	}
+	m.dataMu.RUnlock()
+
+	if !exists {
+		log.Printf("%s: App ID %s not found", handlerName, appID)
+		http.Error(w, "App not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !role.Allows(required) {
+		log.Printf("%s: User %s with role %q not authorized as %s for app %s", handlerName, user.UserID, role, required, appID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	return app, true
+}
+
+// ListAppsHandler returns the apps of the orgs the signed-in user is a member of.
 func (m *Manager) ListAppsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("ListAppsHandler: Received %s request for %s", r.Method, r.URL.Path)
@@ -42,10 +142,25 @@ func (m *Manager) ListAppsHandler() http.HandlerFunc {
 			return
 		}
 
+		user, ok := identityFromContext(r)
+		if !ok {
+			log.Println("ListAppsHandler: Missing user ID in context")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		m.dataMu.RLock()
 		apps := make([]App, 0, len(m.data.Apps))
 		for _, app := range m.data.Apps {
-			apps = append(apps, *app)
+			role := m.roleFor(user, app)
+			if role == "" {
+				continue
+			}
+			listed := app.public()
+			if !role.Allows(RoleAdmin) {
+				listed.Keys = nil // only admins manage keys
+			}
+			apps = append(apps, listed)
 		}
 		m.dataMu.RUnlock()
 
@@ -55,7 +170,7 @@ func (m *Manager) ListAppsHandler() http.HandlerFunc {
 			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 			return
 		}
-		log.Println("ListAppsHandler: Listed all apps")
+		log.Printf("ListAppsHandler: Listed %d apps for user %s", len(apps), user.UserID)
 	}
 }
 
@@ -70,9 +185,17 @@ func (m *Manager) CreateAppHandler() http.HandlerFunc {
 			return
 		}
 
+		user, ok := identityFromContext(r)
+		if !ok {
+			log.Println("CreateAppHandler: Missing user ID in context")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		var req struct {
 			Name           string   `json:"name"`
 			AllowedOrigins []string `json:"allowed_origins"`
+			OrgID          string   `json:"org_id"` // defaults to the user's personal org
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			log.Printf("CreateAppHandler: Invalid request body: %v", err)
@@ -86,7 +209,17 @@ func (m *Manager) CreateAppHandler() http.HandlerFunc {
 			return
 		}
 
-		app, err := m.CreateApp(req.Name, req.AllowedOrigins)
+		if req.OrgID != "" && !m.roleInOrg(user, req.OrgID).Allows(RoleAdmin) {
+			log.Printf("CreateAppHandler: User %s not authorized to create apps in org %s", user.UserID, req.OrgID)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		app, err := m.CreateApp(req.Name, req.AllowedOrigins, user.UserID, req.OrgID)
+		if errors.Is(err, ErrAppNameTaken) {
+			http.Error(w, "App name already in use", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			log.Printf("CreateAppHandler: Failed to create app: %v", err)
 			http.Error(w, fmt.Sprintf("Failed to create app: %v", err), http.StatusInternalServerError)
@@ -98,14 +231,17 @@ func (m *Manager) CreateAppHandler() http.HandlerFunc {
 		resp := App{
 			ID:             app.ID,
 			Name:           app.Name,
-			APIKey:         app.APIKey,
+			APIKey:         app.Keys[0].Key, // kept for clients predating key lists
+			Keys:           app.Keys,
 			CreatedAt:      app.CreatedAt,
 			AllowedOrigins: app.AllowedOrigins,
+			OwnerID:        app.OwnerID,
+			OrgID:          app.OrgID,
 		}
 		if err := json.NewEncoder(w).Encode(resp); err != nil {
 			log.Printf("CreateAppHandler: Failed to encode response: %v", err)
 		}
-		log.Printf("CreateAppHandler: Created app ID: %s", app.ID)
+		log.Printf("CreateAppHandler: Created app ID: %s in org %s for user %s", app.ID, app.OrgID, user.UserID)
 	}
 }
 
@@ -128,8 +264,12 @@ func (m *Manager) UpdateAppHandler() http.HandlerFunc {
 		}
 
 		var req struct {
-			Name           string   `json:"name"`
-			AllowedOrigins []string `json:"allowed_origins"`
+			Name           string     `json:"name"`
+			AllowedOrigins []string   `json:"allowed_origins"`
+			Quotas         *Quotas    `json:"quotas"`     // unchanged if omitted
+			BotPolicy      *BotPolicy `json:"bot_policy"` // unchanged if omitted
+			Privacy        *Privacy   `json:"privacy"`    // unchanged if omitted
+			Redaction      *Redaction `json:"redaction"`  // unchanged if omitted
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			log.Printf("UpdateAppHandler: Invalid request body: %v", err)
@@ -142,6 +282,28 @@ func (m *Manager) UpdateAppHandler() http.HandlerFunc {
 			http.Error(w, "Name is required", http.StatusBadRequest)
 			return
 		}
+		if req.Quotas != nil {
+			if err := req.Quotas.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.BotPolicy != nil && !req.BotPolicy.Valid() {
+			http.Error(w, "Invalid bot policy", http.StatusBadRequest)
+			return
+		}
+		if req.Privacy != nil {
+			if err := req.Privacy.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Redaction != nil {
+			if err := req.Redaction.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
 		m.dataMu.Lock()
 		app, exists := m.data.Apps[appID]
@@ -152,19 +314,39 @@ func (m *Manager) UpdateAppHandler() http.HandlerFunc {
 			return
 		}
 
+		// All fields are applied with one save, so a failure leaves none of them applied
+		previous := *app
 		app.Name = req.Name
 		app.AllowedOrigins = req.AllowedOrigins
-		m.data.Apps[appID] = app
+		if req.Quotas != nil {
+			app.Quotas = *req.Quotas
+		}
+		if req.BotPolicy != nil {
+			app.BotPolicy = *req.BotPolicy
+		}
+		if req.Privacy != nil {
+			app.Privacy = *req.Privacy
+		}
+		if req.Redaction != nil {
+			app.Redaction = *req.Redaction
+		}
 		if err := m.save(); err != nil {
+			*app = previous // Rollback on save failure
 			m.dataMu.Unlock()
 			log.Printf("UpdateAppHandler: Failed to save app: %v", err)
 			http.Error(w, "Failed to save app", http.StatusInternalServerError)
 			return
 		}
+		updated := app.public()
 		m.dataMu.Unlock()
 
+		if updated.Privacy.NoStringSamples && !previous.Privacy.NoStringSamples {
+			// Samples are collected again from new events, without strings
+			m.catalog.clearSamples(appID)
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(app); err != nil {
+		if err := json.NewEncoder(w).Encode(updated); err != nil {
 			log.Printf("UpdateAppHandler: Failed to encode response: %v", err)
 		}
 		log.Printf("UpdateAppHandler: Updated app ID: %s", appID)
@@ -197,10 +379,15 @@ func (m *Manager) DeleteAppHandler() http.HandlerFunc {
 			return
 		}
 
+		m.unindexKeys(m.data.Apps[appID])
 		delete(m.data.Apps, appID)
 		m.cachesMu.Lock()
 		delete(m.caches, appID)
 		m.cachesMu.Unlock()
+		m.violations.forget(appID)
+		m.catalog.forget(appID)
+		m.redactors.forget(appID)
+		m.erasures.forget(appID)
 
 		if err := m.save(); err != nil {
 			m.dataMu.Unlock()
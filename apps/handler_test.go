@@ -0,0 +1,211 @@
+package apps
+
+import (
+	"analytics/config"
+	fba "analytics/firebase_auth"
+	"analytics/store"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestManager returns a Manager backed by files in a temporary directory.
+func newTestManager(t *testing.T, cfg config.AppsConfig) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	events := store.NewFileStore(filepath.Join(dir, "data"))
+	t.Cleanup(func() { events.Close() })
+
+	manager, err := NewManager(filepath.Join(dir, "app-metadata.json"), events, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	return manager
+}
+
+// withUser returns r as authenticated by FirebaseAuthMiddleware for userID.
+func withUser(r *http.Request, userID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), fba.UserIDKey, userID))
+}
+
+func TestCreateAppHandlerSetsOwner(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/apps/", strings.NewReader(`{"name":"owned"}`))
+	w := httptest.NewRecorder()
+	manager.CrudHandler()(w, withUser(req, "alice"))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var app App
+	json.NewDecoder(w.Body).Decode(&app)
+	if app.OwnerID != "alice" {
+		t.Errorf("Expected owner alice, got %q", app.OwnerID)
+	}
+
+	// Unauthenticated creation is rejected
+	req = httptest.NewRequest(http.MethodPost, "/analytics/api/v1/apps/", strings.NewReader(`{"name":"anon"}`))
+	w = httptest.NewRecorder()
+	manager.CrudHandler()(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+}
+
+func TestCreateAppHandlerNamesPerOrg(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+
+	create := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/apps/", strings.NewReader(`{"name":"shop"}`))
+		w := httptest.NewRecorder()
+		manager.CrudHandler()(w, withUser(req, user))
+		return w
+	}
+
+	var alice, bob App
+	w := create("alice")
+	json.NewDecoder(w.Body).Decode(&alice)
+	w = create("bob")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected another tenant to reuse the name, got %d: %s", w.Code, w.Body.String())
+	}
+	json.NewDecoder(w.Body).Decode(&bob)
+	if alice.ID == "" || alice.ID == bob.ID {
+		t.Errorf("Expected distinct app IDs, got %q and %q", alice.ID, bob.ID)
+	}
+
+	w = create("bob")
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a name taken in the org, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), bob.ID) || strings.Contains(w.Body.String(), alice.ID) {
+		t.Errorf("Expected no app ID in the conflict, got %s", w.Body.String())
+	}
+}
+
+func TestListAppsHandlerFiltersByOwner(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	manager.CreateApp("alice-app", nil, "alice", "")
+	manager.CreateApp("bob-app", nil, "bob", "")
+
+	req := httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps", nil)
+	w := httptest.NewRecorder()
+	manager.ListAppsHandler()(w, withUser(req, "alice"))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var apps []App
+	json.NewDecoder(w.Body).Decode(&apps)
+	if len(apps) != 1 || apps[0].Name != "alice-app" {
+		t.Errorf("Expected only alice-app, got %+v", apps)
+	}
+}
+
+func TestCrudHandlerEnforcesOwnership(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	app, _ := manager.CreateApp("alice-app", nil, "alice", "")
+	start := toMinutesSinceEpoch(time.Now().UTC())
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		user           string
+		expectedStatus int
+	}{
+		{"owner reads events", http.MethodGet, "/events", "", "alice", http.StatusOK},
+		{"other user reads events", http.MethodGet, "/events", "", "bob", http.StatusForbidden},
+		{"other user aggregates", http.MethodGet, "/aggregate", "", "bob", http.StatusForbidden},
+		{"other user streams", http.MethodGet, "/events/stream", "", "bob", http.StatusForbidden},
+		{"other user updates", http.MethodPut, "", `{"name":"stolen"}`, "bob", http.StatusForbidden},
+		{"other user deletes", http.MethodDelete, "", "", "bob", http.StatusForbidden},
+		{"no user", http.MethodGet, "/events", "", "", http.StatusUnauthorized},
+		{"owner updates", http.MethodPut, "", `{"name":"renamed"}`, "alice", http.StatusOK},
+		{"owner deletes", http.MethodDelete, "", "", "alice", http.StatusNoContent},
+		{"deleted app", http.MethodGet, "/events", "", "alice", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/analytics/api/v1/apps/" + app.ID + tt.path
+			if tt.method == http.MethodGet {
+				path += "?start-minutes-since-epoch=" + strconv.FormatInt(start, 10)
+			}
+			req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+			if tt.user != "" {
+				req = withUser(req, tt.user)
+			}
+			w := httptest.NewRecorder()
+			manager.CrudHandler()(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if got, _ := manager.GetApp(app.ID); got != nil {
+		t.Errorf("Expected app to be deleted")
+	}
+}
+
+func TestNewManagerMigratesUnownedApps(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app-metadata.json")
+	legacy := `{"apps":{"abc12345":{"id":"abc12345","name":"legacy","api_key":"key","created_at":"2025-01-01T00:00:00Z","allowed_origins":null}}}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+	events := store.NewFileStore(filepath.Join(dir, "data"))
+	defer events.Close()
+
+	if _, err := NewManager(path, events, config.AppsConfig{DefaultOwnerID: "admin"}); err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	// The migration is persisted
+	manager, err := NewManager(path, events, config.AppsConfig{})
+	if err != nil {
+		t.Fatalf("Failed to reload manager: %v", err)
+	}
+	app, _ := manager.GetApp("abc12345")
+	if app == nil || app.OwnerID != "admin" {
+		t.Errorf("Expected legacy app owned by admin, got %+v", app)
+	}
+}
+
+func TestUpdateAppHandlerRollsBackOnSaveFailure(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	app, _ := manager.CreateApp("before", []string{"https://a.example"}, "alice", "")
+
+	// A directory cannot be written as the metadata file
+	path := manager.path
+	manager.path = t.TempDir()
+	body := `{"name":"after","allowed_origins":["https://b.example"],"quotas":{"monthly":10},"bot_policy":"drop","privacy":{"ip_mode":"drop"},"redaction":{"detectors":["email"]}}`
+	req := httptest.NewRequest(http.MethodPut, "/analytics/api/v1/apps/"+app.ID, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	manager.UpdateAppHandler()(w, req)
+	manager.path = path
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", w.Code)
+	}
+	got, _ := manager.GetApp(app.ID)
+	if got.Name != "before" || len(got.AllowedOrigins) != 1 || got.AllowedOrigins[0] != "https://a.example" {
+		t.Errorf("Expected name and origins unchanged, got %q %v", got.Name, got.AllowedOrigins)
+	}
+	if got.Quotas != (Quotas{}) || got.BotPolicy != "" || got.Privacy.IPMode != "" || !got.Redaction.IsZero() {
+		t.Errorf("Expected settings unchanged, got %+v %q %+v %+v", got.Quotas, got.BotPolicy, got.Privacy, got.Redaction)
+	}
+}
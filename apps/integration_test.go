@@ -47,6 +47,7 @@ func TestGetEvents(t *testing.T) {
 	os.WriteFile(filepath.Join(dirPath, "disk-event1.json"), data, 0644)
 
 	manager := &Manager{
+		events:   newTestFileStore(t),
 		caches:   make(map[string]*EventCache),
 		cachesMu: sync.RWMutex{},
 	}
@@ -82,7 +83,7 @@ func TestGetEvents(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			events, err := manager.getEvents(appID, tt.startMinutes)
+			events, _, err := manager.getEvents(eventsQuery{AppID: appID, StartMinutes: tt.startMinutes})
 
 			if err != nil {
 				t.Errorf("Unexpected error: %v", err)
@@ -130,6 +131,7 @@ func TestGetEventsIntegrationWithNoCache(t *testing.T) {
 	}
 
 	manager := &Manager{
+		events:   newTestFileStore(t),
 		caches:   make(map[string]*EventCache),
 		cachesMu: sync.RWMutex{},
 	}
@@ -142,7 +144,7 @@ func TestGetEventsIntegrationWithNoCache(t *testing.T) {
 
 	t.Run("no cache - should go to disk", func(t *testing.T) {
 		startMinutes := toMinutesSinceEpoch(baseTime.Add(-10 * time.Minute))
-		events, err := manager.getEvents(appID, startMinutes)
+		events, _, err := manager.getEvents(eventsQuery{AppID: appID, StartMinutes: startMinutes})
 
 		if err != nil {
 			t.Errorf("Unexpected error: %v", err)
@@ -0,0 +1,371 @@
+package apps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Scope is an operation an API key may be used for.
+type Scope string
+
+const (
+	ScopeIngest     Scope = "ingest"      // send events; the only scope of keys shipped to browsers
+	ScopeReadEvents Scope = "read-events" // query, aggregate and stream events
+	ScopeAdmin      Scope = "admin"       // change the app and its keys; includes read-events
+)
+
+// Valid reports whether s is a known scope.
+func (s Scope) Valid() bool {
+	return s == ScopeIngest || s == ScopeReadEvents || s == ScopeAdmin
+}
+
+// roleScopes is the key scope standing in for each org role. There is none for
+// RoleOwner: deleting an app always needs a signed-in owner.
+var roleScopes = map[Role]Scope{
+	RoleViewer: ScopeReadEvents,
+	RoleAdmin:  ScopeAdmin,
+}
+
+// APIKey is one of the keys an app accepts in the X-API-Key header.
+// Keys without scopes predate scopes and can only ingest.
+//
+// Only the SHA-256 hash of a key is stored; the key itself is returned once,
+// when it is created, and is identified afterwards by its ID, label and hint.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Label     string     `json:"label"`
+	Key       string     `json:"key,omitempty"`  // plaintext, only in the response creating the key
+	Hash      string     `json:"hash,omitempty"` // hex SHA-256 of the key, never sent to clients
+	Hint      string     `json:"hint"`           // last characters of the key
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // set when the key is rotated out
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key is accepted at time now.
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// HasScope reports whether the key may be used for scope.
+func (k *APIKey) HasScope(scope Scope) bool {
+	if len(k.Scopes) == 0 {
+		return scope == ScopeIngest
+	}
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin && scope == ScopeReadEvents {
+			return true
+		}
+	}
+	return false
+}
+
+// public returns a copy of the key safe to send to clients.
+func (k *APIKey) public() *APIKey {
+	copied := *k
+	copied.Hash = ""
+	return &copied
+}
+
+// setSecret stores the hash and hint of key in place of the key itself.
+func (k *APIKey) setSecret(key string) {
+	k.Key = ""
+	k.Hash = hashAPIKey(key)
+	k.Hint = KeyHint(key)
+}
+
+// KeyHint returns the last characters of a key, enough to tell keys apart in
+// listings and logs without revealing them. Keys too short to cut are hidden.
+func KeyHint(key string) string {
+	if len(key) <= 8 {
+		return ""
+	}
+	return key[len(key)-4:]
+}
+
+// hashAPIKey returns the hex SHA-256 of a key, under which it is stored and indexed.
+// Keys are random, so an unsalted fast hash is enough.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey returns a new key to store and its plaintext.
+func newAPIKey(label string, scopes []Scope) (*APIKey, string, error) {
+	id, err := GenerateUUIDv7()
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to create key ID: %w", err)
+	}
+	secret, err := GenerateUUIDv7()
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to create API key: %w", err)
+	}
+	key := &APIKey{ID: id, Label: label, Scopes: scopes, CreatedAt: time.Now().UTC()}
+	key.setSecret(secret)
+	return key, secret, nil
+}
+
+// keyRef locates an indexed key.
+type keyRef struct {
+	appID string
+	key   *APIKey
+}
+
+// indexKeys adds the keys of an app to the key index. The caller must hold the dataMu write lock.
+func (m *Manager) indexKeys(app *App) {
+	for _, key := range app.Keys {
+		m.keyIndex[key.Hash] = keyRef{appID: app.ID, key: key}
+	}
+}
+
+// unindexKeys removes the keys of an app from the key index. The caller must hold the dataMu write lock.
+func (m *Manager) unindexKeys(app *App) {
+	for _, key := range app.Keys {
+		delete(m.keyIndex, key.Hash)
+	}
+}
+
+// key returns the app's key with the given ID, or nil.
+func (a *App) key(keyID string) *APIKey {
+	for _, key := range a.Keys {
+		if key.ID == keyID {
+			return key
+		}
+	}
+	return nil
+}
+
+// IssueKey adds a new key to an app. With rotate, the app's other active keys
+// with the same scopes expire after grace instead of staying valid indefinitely.
+func (m *Manager) IssueKey(appID, label string, scopes []Scope, rotate bool, grace time.Duration) (*APIKey, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return nil, fmt.Errorf("app %s not found", appID)
+	}
+
+	key, secret, err := newAPIKey(label, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(grace)
+	rotated := make(map[*APIKey]*time.Time) // key -> previous expiry
+	if rotate {
+		for _, other := range app.Keys {
+			if other.Active(now) && sameScopes(other, key) && (other.ExpiresAt == nil || other.ExpiresAt.After(expiresAt)) {
+				rotated[other] = other.ExpiresAt
+				other.ExpiresAt = &expiresAt
+			}
+		}
+	}
+	app.Keys = append(app.Keys, key)
+	m.keyIndex[key.Hash] = keyRef{appID: appID, key: key}
+
+	if err := m.save(); err != nil {
+		// Rollback on save failure
+		app.Keys = app.Keys[:len(app.Keys)-1]
+		delete(m.keyIndex, key.Hash)
+		for other, previous := range rotated {
+			other.ExpiresAt = previous
+		}
+		return nil, fmt.Errorf("save key: %w", err)
+	}
+
+	issued := key.public()
+	issued.Key = secret
+	return issued, nil
+}
+
+// UpdateKey changes the label of an app's key.
+func (m *Manager) UpdateKey(appID, keyID, label string) (*APIKey, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return nil, fmt.Errorf("app %s not found", appID)
+	}
+	key := app.key(keyID)
+	if key == nil {
+		return nil, fmt.Errorf("key %s not found", keyID)
+	}
+
+	previous := key.Label
+	key.Label = label
+	if err := m.save(); err != nil {
+		key.Label = previous // Rollback on save failure
+		return nil, fmt.Errorf("save key: %w", err)
+	}
+
+	return key.public(), nil
+}
+
+// RevokeKey stops an app's key from being accepted immediately. The key is
+// kept, marked revoked, so the app's key history stays visible.
+func (m *Manager) RevokeKey(appID, keyID string) error {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return fmt.Errorf("app %s not found", appID)
+	}
+	key := app.key(keyID)
+	if key == nil {
+		return fmt.Errorf("key %s not found", keyID)
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	if err := m.save(); err != nil {
+		key.RevokedAt = nil // Rollback on save failure
+		return fmt.Errorf("save key: %w", err)
+	}
+
+	return nil
+}
+
+// sameScopes reports whether two keys grant the same scopes.
+func sameScopes(a, b *APIKey) bool {
+	for _, scope := range []Scope{ScopeIngest, ScopeReadEvents, ScopeAdmin} {
+		if a.HasScope(scope) != b.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// isKeysPath reports whether path is /apps/<id>/keys or below.
+func isKeysPath(path string) bool {
+	sub := appSubPath(path)
+	return sub == "keys" || strings.HasPrefix(sub, "keys/")
+}
+
+// appSubPath returns the part of an /apps/<id>/... path after the app ID.
+func appSubPath(path string) string {
+	_, sub, _ := strings.Cut(strings.TrimPrefix(path, "/analytics/api/v1/apps/"), "/")
+	return sub
+}
+
+// KeysHandler manages the API keys of an app; CrudHandler has already checked
+// that the user is an admin of the app's org.
+//   - GET /apps/<id>/keys: list keys, including expired and revoked ones
+//   - POST /apps/<id>/keys: issue a key {"label", "scopes", "rotate", "grace_minutes"};
+//     scopes default to ingest, and with rotate the other active keys with the
+//     same scopes expire after the grace period
+//   - PUT /apps/<id>/keys/<keyID>: relabel a key {"label"}
+//   - DELETE /apps/<id>/keys/<keyID>: revoke a key immediately
+func (m *Manager) KeysHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("KeysHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		appID, err := extractAppID(r.URL.Path)
+		if err != nil {
+			http.Error(w, "invalid app ID", http.StatusBadRequest)
+			return
+		}
+		keyID := strings.Trim(strings.TrimPrefix(appSubPath(r.URL.Path), "keys"), "/")
+
+		switch {
+		case r.Method == http.MethodGet && keyID == "":
+			app, exists := m.GetApp(appID)
+			if !exists {
+				http.Error(w, "App not found", http.StatusNotFound)
+				return
+			}
+			m.dataMu.RLock()
+			keys := make([]*APIKey, 0, len(app.Keys))
+			for _, key := range app.Keys {
+				keys = append(keys, key.public())
+			}
+			m.dataMu.RUnlock()
+			writeJSON(w, "KeysHandler", http.StatusOK, keys)
+
+		case r.Method == http.MethodPost && keyID == "":
+			var req struct {
+				Label        string  `json:"label"`
+				Scopes       []Scope `json:"scopes"`
+				Rotate       bool    `json:"rotate"`
+				GraceMinutes *int    `json:"grace_minutes"` // defaults to the configured grace period
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				log.Printf("KeysHandler: Invalid request body: %v", err)
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if len(req.Scopes) == 0 {
+				req.Scopes = []Scope{ScopeIngest}
+			}
+			for _, scope := range req.Scopes {
+				if !scope.Valid() {
+					http.Error(w, fmt.Sprintf("invalid scope %q, expected ingest, read-events or admin", scope), http.StatusBadRequest)
+					return
+				}
+			}
+			grace := m.keyGracePeriod
+			if req.GraceMinutes != nil {
+				if *req.GraceMinutes < 0 {
+					http.Error(w, "grace_minutes must not be negative", http.StatusBadRequest)
+					return
+				}
+				grace = time.Duration(*req.GraceMinutes) * time.Minute
+			}
+
+			key, err := m.IssueKey(appID, req.Label, req.Scopes, req.Rotate, grace)
+			if err != nil {
+				log.Printf("KeysHandler: Failed to issue key: %v", err)
+				http.Error(w, fmt.Sprintf("Failed to issue key: %v", err), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, "KeysHandler", http.StatusCreated, key)
+			log.Printf("KeysHandler: Issued key %s with scopes %v for app %s (rotate=%v, grace=%s)", key.ID, key.Scopes, appID, req.Rotate, grace)
+
+		case r.Method == http.MethodPut && keyID != "":
+			var req struct {
+				Label string `json:"label"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				log.Printf("KeysHandler: Invalid request body: %v", err)
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+
+			key, err := m.UpdateKey(appID, keyID, req.Label)
+			if err != nil {
+				log.Printf("KeysHandler: Failed to update key: %v", err)
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			writeJSON(w, "KeysHandler", http.StatusOK, key)
+
+		case r.Method == http.MethodDelete && keyID != "":
+			if err := m.RevokeKey(appID, keyID); err != nil {
+				log.Printf("KeysHandler: Failed to revoke key: %v", err)
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			log.Printf("KeysHandler: Revoked key %s of app %s", keyID, appID)
+
+		default:
+			http.Error(w, "Invalid path or method", http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package apps
+
+import (
+	"analytics/config"
+	"analytics/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyRotation(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{KeyGraceMinutes: 60})
+	app, _ := manager.CreateApp("keys-app", nil, "alice", "")
+	oldKey := app.Keys[0]
+
+	keysRequest := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/analytics/api/v1/apps/"+app.ID+"/keys"+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		manager.CrudHandler()(w, withUser(req, "alice"))
+		return w
+	}
+
+	w := keysRequest(http.MethodPost, "", `{"label":"web v2","rotate":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var newKey APIKey
+	json.NewDecoder(w.Body).Decode(&newKey)
+
+	// Both keys work during the grace period
+	for _, key := range []string{oldKey.Key, newKey.Key} {
+		if got, err := manager.GetAppByAPIKey(key, ScopeIngest); err != nil || got.ID != app.ID {
+			t.Errorf("Expected key %s to be accepted, got %v", key, err)
+		}
+	}
+	if stored, _ := manager.GetApp(app.ID); stored.key(oldKey.ID).ExpiresAt == nil {
+		t.Errorf("Expected rotated key to expire")
+	} else if until := time.Until(*stored.key(oldKey.ID).ExpiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("Expected rotated key to expire in an hour, got %s", until)
+	}
+
+	// Relabel, then revoke the new key
+	if w := keysRequest(http.MethodPut, "/"+newKey.ID, `{"label":"web"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 relabelling, got %d", w.Code)
+	}
+	if w := keysRequest(http.MethodDelete, "/"+newKey.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 revoking, got %d", w.Code)
+	}
+	if _, err := manager.GetAppByAPIKey(newKey.Key, ScopeIngest); err == nil {
+		t.Errorf("Expected revoked key to be rejected")
+	}
+
+	// Revoked keys are still listed
+	w = keysRequest(http.MethodGet, "", "")
+	var keys []APIKey
+	json.NewDecoder(w.Body).Decode(&keys)
+	if len(keys) != 2 || keys[1].Label != "web" || keys[1].RevokedAt == nil {
+		t.Errorf("Expected relabelled revoked key in list, got %+v", keys)
+	}
+
+	// Rotating with no grace expires the old key at once
+	keysRequest(http.MethodPost, "", `{"rotate":true,"grace_minutes":0}`)
+	if _, err := manager.GetAppByAPIKey(oldKey.Key, ScopeIngest); err == nil {
+		t.Errorf("Expected old key to be rejected after rotation without grace")
+	}
+}
+
+func TestKeysRequireAdmin(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	org, _ := manager.CreateOrg("team", "alice")
+	manager.SetMember(org.ID, "bob", "", RoleViewer)
+	app, _ := manager.CreateApp("team-app", nil, "alice", org.ID)
+
+	req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/apps/"+app.ID+"/keys", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	manager.CrudHandler()(w, withUser(req, "bob"))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for viewer, got %d", w.Code)
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app-metadata.json")
+	legacy := `{"apps":{"abc12345":{"id":"abc12345","name":"legacy","api_key":"legacy-key","created_at":"2025-01-01T00:00:00Z","owner_id":"alice"}}}`
+	os.WriteFile(path, []byte(legacy), 0644)
+	events := store.NewFileStore(filepath.Join(dir, "data"))
+	defer events.Close()
+
+	manager, err := NewManager(path, events, config.AppsConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	app, err := manager.GetAppByAPIKey("legacy-key", ScopeIngest)
+	if err != nil {
+		t.Fatalf("Expected legacy key to be accepted: %v", err)
+	}
+	if app.APIKey != "" || len(app.Keys) != 1 || app.Keys[0].Label != "default" {
+		t.Errorf("Expected legacy key moved into key list, got %+v", app)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "legacy-key") {
+		t.Errorf("Expected legacy key to be stored hashed")
+	}
+}
+
+func TestAPIKeysStoredHashed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app-metadata.json")
+	events := store.NewFileStore(filepath.Join(dir, "data"))
+	defer events.Close()
+
+	manager, _ := NewManager(path, events, config.AppsConfig{})
+	app, _ := manager.CreateApp("hashed-app", nil, "alice", "")
+	secret := app.Keys[0].Key
+	if secret == "" {
+		t.Fatal("Expected plaintext key on creation")
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), secret) {
+		t.Errorf("Expected metadata not to contain the plaintext key")
+	}
+	if !strings.Contains(string(data), hashAPIKey(secret)) {
+		t.Errorf("Expected metadata to contain the key hash")
+	}
+
+	// The index is rebuilt on load
+	reloaded, _ := NewManager(path, events, config.AppsConfig{})
+	if got, err := reloaded.GetAppByAPIKey(secret, ScopeIngest); err != nil || got.ID != app.ID {
+		t.Errorf("Expected key to be accepted after reload, got %v", err)
+	}
+	if stored, _ := reloaded.GetApp(app.ID); stored.Keys[0].Key != "" || stored.Keys[0].Hint != secret[len(secret)-4:] {
+		t.Errorf("Expected stored key without plaintext and with hint, got %+v", stored.Keys[0])
+	}
+
+	// Deleting the app drops its keys from the index
+	req := httptest.NewRequest(http.MethodDelete, "/analytics/api/v1/apps/"+app.ID, nil)
+	reloaded.CrudHandler()(httptest.NewRecorder(), withUser(req, "alice"))
+	if _, err := reloaded.GetAppByAPIKey(secret, ScopeIngest); err == nil {
+		t.Errorf("Expected key of deleted app to be rejected")
+	}
+}
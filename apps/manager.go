@@ -1,14 +1,15 @@
 package apps
 
 import (
+	"analytics/config"
 	"analytics/models"
-	"crypto/sha256"
+	"analytics/store"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -21,32 +22,61 @@ import (
 // - add/delete/list apps in admin page
 // //
 type Manager struct {
-	path     string
-	data     *Data                  // app collection
-	caches   map[string]*EventCache // Per-app caches
-	dataMu   sync.RWMutex           // Protects data
-	cachesMu sync.RWMutex           // Protects caches
+	path           string
+	data           *Data                  // app collection
+	events         store.EventStore       // Persisted events
+	caches         map[string]*EventCache // Per-app caches
+	streams        streamHub              // Live stream clients
+	keyGracePeriod time.Duration          // Validity of rotated-out API keys
+	keyIndex       map[string]keyRef      // API key hash -> key, protected by dataMu
+	usage          *usageLedger           // Per-app ingestion usage
+	violations     violationLog           // Recent schema violations
+	catalog        *catalog               // Event names and properties seen per app
+	redactors      redactorCache          // Compiled redaction rules per app
+	erasures       erasureJobs            // Erasure jobs of users' events
+	dataMu         sync.RWMutex           // Protects data
+	cachesMu       sync.RWMutex           // Protects caches
 }
 
 type Data struct {
 	Apps map[string]*App `json:"apps"` // appId -> *App
+	Orgs map[string]*Org `json:"orgs"` // orgId -> *Org
 }
 
 type App struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	APIKey         string    `json:"api_key"`
-	CreatedAt      time.Time `json:"created_at"`
-	AllowedOrigins []string  `json:"allowed_origins"`
+	ID             string      `json:"id"`
+	Name           string      `json:"name"`
+	APIKey         string      `json:"api_key,omitempty"` // single key of older versions, see migrateKeys
+	Keys           []*APIKey   `json:"keys"`
+	CreatedAt      time.Time   `json:"created_at"`
+	AllowedOrigins []string    `json:"allowed_origins"`
+	OwnerID        string      `json:"owner_id"` // Firebase user ID of the creator
+	OrgID          string      `json:"org_id"`   // org whose members can access the app
+	Quotas         Quotas      `json:"quotas"`
+	BotPolicy      BotPolicy   `json:"bot_policy,omitempty"`
+	Privacy        Privacy     `json:"privacy"`
+	Redaction      Redaction   `json:"redaction"`
+	Schema         EventSchema `json:"schema"`
+
+	// Tombstones holds the hashed identifiers of users whose events were erased,
+	// with the time of the erasure. Events of these users are dropped at ingestion.
+	Tombstones map[string]time.Time `json:"tombstones,omitempty"`
+
+	// PendingErasures holds the erasure jobs not yet finished, resumed on startup.
+	PendingErasures []*PendingErasure `json:"pending_erasures,omitempty"`
 }
 
-func NewManager(path string) (*Manager, error) {
+func NewManager(path string, events store.EventStore, cfg config.AppsConfig) (*Manager, error) {
 	m := &Manager{
 		path: path,
 		data: &Data{
 			Apps: make(map[string]*App),
+			Orgs: make(map[string]*Org),
 		},
-		caches: make(map[string]*EventCache),
+		events:         events,
+		caches:         make(map[string]*EventCache),
+		keyGracePeriod: time.Duration(cfg.KeyGraceMinutes) * time.Minute,
+		keyIndex:       make(map[string]keyRef),
 	}
 
 	// Try to load the config file
@@ -62,22 +92,59 @@ func NewManager(path string) (*Manager, error) {
 		}
 	}
 
+	if err := m.migrate(cfg); err != nil {
+		return nil, fmt.Errorf("migrate apps metadata: %w", err)
+	}
+
+	for _, app := range m.data.Apps {
+		m.indexKeys(app)
+	}
+
+	usage, err := newUsageLedger(cfg.UsagePath)
+	if err != nil {
+		return nil, fmt.Errorf("load usage: %w", err)
+	}
+	m.usage = usage
+
+	catalog, err := newCatalog(cfg.CatalogPath)
+	if err != nil {
+		usage.close()
+		return nil, fmt.Errorf("load catalog: %w", err)
+	}
+	m.catalog = catalog
+
 	// Load recent events into cache
 	if err := m.loadRecentEvents(); err != nil {
 		log.Printf("NewManager: Failed to load recent events: %v", err)
 		// Continue despite error to allow startup
 	}
 
+	// After loading the cache, so resumed jobs also clear the cached events
+	m.resumeErasures()
+
 	return m, nil
 }
 
+// Close waits for running erasure jobs and writes pending usage counters and
+// catalogue changes. The manager must not be used afterwards.
+func (m *Manager) Close() error {
+	m.erasures.wait()
+	return errors.Join(m.usage.close(), m.catalog.close())
+}
+
 func (m *Manager) load() error {
 	data, err := os.ReadFile(m.path)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, &m.data)
+	if err := json.Unmarshal(data, &m.data); err != nil {
+		return err
+	}
+	if m.data.Orgs == nil {
+		m.data.Orgs = make(map[string]*Org)
+	}
+	return nil
 }
 
 func (m *Manager) save() error {
@@ -95,10 +162,92 @@ func (m *Manager) save() error {
 	return nil
 }
 
+// migrate upgrades apps metadata written by older versions and saves it if anything changed.
+func (m *Manager) migrate(cfg config.AppsConfig) error {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	owners := m.migrateOwners(cfg.DefaultOwnerID)
+	orgs := m.migrateOrgs()
+	keys, err := m.migrateKeys()
+	if err != nil {
+		return err
+	}
+	if owners == 0 && orgs == 0 && keys == 0 {
+		return nil
+	}
+	return m.save()
+}
+
+// migrateOwners assigns apps created before apps had owners to defaultOwnerID.
+// Without a default owner they stay unowned, and so inaccessible to every user.
+func (m *Manager) migrateOwners(defaultOwnerID string) int {
+	migrated := 0
+	for _, app := range m.data.Apps {
+		if app.OwnerID != "" {
+			continue
+		}
+		if defaultOwnerID == "" {
+			log.Printf("migrateOwners: App %s has no owner and no default_owner_id is configured", app.ID)
+			continue
+		}
+		app.OwnerID = defaultOwnerID
+		migrated++
+	}
+	if migrated > 0 {
+		log.Printf("migrateOwners: Assigned %d apps to owner %s", migrated, defaultOwnerID)
+	}
+	return migrated
+}
+
+// migrateOrgs moves apps created before orgs into the personal org of their owner.
+func (m *Manager) migrateOrgs() int {
+	migrated := 0
+	for _, app := range m.data.Apps {
+		if app.OrgID != "" || app.OwnerID == "" {
+			continue
+		}
+		app.OrgID = m.ensurePersonalOrg(app.OwnerID).ID
+		migrated++
+	}
+	if migrated > 0 {
+		log.Printf("migrateOrgs: Moved %d apps into personal orgs", migrated)
+	}
+	return migrated
+}
+
+// migrateKeys moves the single API key of apps created before key rotation
+// into their key list, and replaces keys stored in plaintext with their hash.
+func (m *Manager) migrateKeys() (int, error) {
+	migrated := 0
+	for _, app := range m.data.Apps {
+		if app.APIKey != "" {
+			key, _, err := newAPIKey("default", []Scope{ScopeIngest})
+			if err != nil {
+				return migrated, err
+			}
+			key.setSecret(app.APIKey)
+			key.CreatedAt = app.CreatedAt
+			app.Keys = append(app.Keys, key)
+			app.APIKey = ""
+			migrated++
+		}
+		for _, key := range app.Keys {
+			if key.Key != "" {
+				key.setSecret(key.Key)
+				migrated++
+			}
+		}
+	}
+	if migrated > 0 {
+		log.Printf("migrateKeys: Hashed %d API keys", migrated)
+	}
+	return migrated, nil
+}
+
 func (m *Manager) loadRecentEvents() error {
 	startTime := time.Now().UTC().Add(-35 * time.Minute)
-	startDate := startTime.UTC().Truncate(24 * time.Hour)
-	endDate := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	endTime := time.Now().UTC().Add(24 * time.Hour)
 
 	m.dataMu.RLock()
 	appIDs := make([]string, 0, len(m.data.Apps))
@@ -108,36 +257,14 @@ func (m *Manager) loadRecentEvents() error {
 	m.dataMu.RUnlock()
 
 	for _, appID := range appIDs {
-		for date := startDate; !date.After(endDate); date = date.Add(24 * time.Hour) {
-			dir := filepath.Join("data", appID, date.Format("20060102"))
-			files, err := os.ReadDir(dir)
-			if os.IsNotExist(err) {
-				continue
-			}
-			if err != nil {
-				log.Printf("loadRecentEvents: Failed to read directory %s for app %s: %v", dir, appID, err)
-				continue
-			}
-
-			for _, file := range files {
-				if !strings.HasSuffix(file.Name(), ".json") {
-					continue
-				}
-				data, err := os.ReadFile(filepath.Join(dir, file.Name()))
-				if err != nil {
-					log.Printf("loadRecentEvents: Failed to read file %s for app %s: %v", file.Name(), appID, err)
-					continue
-				}
-				var event models.Event
-				if err := json.Unmarshal(data, &event); err != nil {
-					log.Printf("loadRecentEvents: Failed to parse event %s for app %s: %v", file.Name(), appID, err)
-					continue
-				}
-				if !event.Timestamp.Before(startTime) {
-					m.AddEvent(&event)
-					log.Printf("loadRecentEvents: Loaded event %s for app %s", event.EventID, appID)
-				}
-			}
+		err := m.events.Scan(appID, startTime, endTime, func(event models.Event) error {
+			m.AddEvent(&event)
+			log.Printf("loadRecentEvents: Loaded event %s for app %s", event.EventID, appID)
+			return nil
+		})
+		if err != nil {
+			log.Printf("loadRecentEvents: Failed to scan events for app %s: %v", appID, err)
+			continue
 		}
 		log.Printf("loadRecentEvents: Completed loading events for app %s", appID)
 	}
@@ -147,66 +274,129 @@ func (m *Manager) loadRecentEvents() error {
 
 func (m *Manager) AddEvent(event *models.Event) {
 	m.cachesMu.Lock()
-	defer m.cachesMu.Unlock()
-
 	// Initialize cache for app if not exists
 	if _, exists := m.caches[event.AppID]; !exists {
 		m.caches[event.AppID] = NewEventCache()
 	}
 	m.caches[event.AppID].Add(event)
+	m.cachesMu.Unlock()
+
+	if m.catalog != nil {
+		m.dataMu.RLock()
+		app := m.data.Apps[event.AppID]
+		stringSamples := app != nil && !app.Privacy.NoStringSamples
+		m.dataMu.RUnlock()
+		m.catalog.record(event, stringSamples)
+	}
+
+	m.streams.publish(event)
 }
 
-func (m *Manager) CreateApp(name string, allowedOrigins []string) (*App, error) {
+// ErrAppNameTaken is returned by CreateApp for a name already used in the org.
+var ErrAppNameTaken = errors.New("app name already in use in this org")
+
+// CreateApp creates an app in orgID, or in the personal org of ownerID if orgID is empty.
+// It returns a copy of the app whose key holds the plaintext, which is not stored.
+func (m *Manager) CreateApp(name string, allowedOrigins []string, ownerID string, orgID string) (*App, error) {
+	// Random rather than derived from the name, so that tenants picking the
+	// same name neither collide nor learn each other's app IDs
+	id, err := GenerateUUIDv7()
+	if err != nil {
+		return nil, fmt.Errorf("generate app ID: %w", err)
+	}
+
 	m.dataMu.Lock()
 	defer m.dataMu.Unlock()
 
-	// Generate ID by hashing the name
-	hash := sha256.Sum256([]byte(name))
-	id := fmt.Sprintf("%x", hash)[:8] // Use first 8 characters of hex-encoded hash
+	createdOrg := ""
+	if orgID == "" {
+		if _, exists := m.data.Orgs[personalOrgID(ownerID)]; !exists {
+			createdOrg = personalOrgID(ownerID)
+		}
+		orgID = m.ensurePersonalOrg(ownerID).ID
+	} else if _, exists := m.data.Orgs[orgID]; !exists {
+		return nil, fmt.Errorf("org %s not found", orgID)
+	}
 
-	// Check if app with this ID already exists
-	if _, exists := m.data.Apps[id]; exists {
-		return nil, fmt.Errorf("app with name %s already exists (ID: %s)", name, id)
+	for _, app := range m.data.Apps {
+		if app.OrgID == orgID && app.Name == name {
+			return nil, ErrAppNameTaken
+		}
 	}
 
 	// Generate API key
-	apiKey, err := GenerateUUIDv7()
+	apiKey, secret, err := newAPIKey("default", []Scope{ScopeIngest})
 	if err != nil {
-		return nil, fmt.Errorf("unable to create API key: %w", err)
+		return nil, err
 	}
 
 	// Create new App
 	app := &App{
 		ID:             id,
 		Name:           name,
-		APIKey:         apiKey,
+		Keys:           []*APIKey{apiKey},
 		CreatedAt:      time.Now().UTC(),
 		AllowedOrigins: allowedOrigins,
+		OwnerID:        ownerID,
+		OrgID:          orgID,
 	}
 
 	// Store the app
 	m.data.Apps[id] = app
+	m.indexKeys(app)
 
 	// Save to config file
 	if err := m.save(); err != nil {
 		delete(m.data.Apps, id) // Rollback on save failure
+		delete(m.data.Orgs, createdOrg)
+		m.unindexKeys(app)
 		return nil, fmt.Errorf("save app: %w", err)
 	}
 
+	// The plaintext key is only ever returned here
+	created := app.public()
+	created.Keys[0].Key = secret
+	return &created, nil
+}
+
+// GetAppByAPIKey returns the app of an active key that has scope. An empty scope accepts any active key.
+func (m *Manager) GetAppByAPIKey(apiKey string, scope Scope) (*App, error) {
+	app, key, err := m.lookupAPIKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" && !key.HasScope(scope) {
+		return nil, fmt.Errorf("API key lacks scope %s", scope)
+	}
 	return app, nil
 }
 
-func (m *Manager) GetAppByAPIKey(apiKey string) (*App, error) {
+// lookupAPIKey returns the app of an active key and a copy of the key.
+func (m *Manager) lookupAPIKey(apiKey string) (*App, APIKey, error) {
+	hash := hashAPIKey(apiKey)
+
 	m.dataMu.RLock()
 	defer m.dataMu.RUnlock()
 
-	for _, app := range m.data.Apps {
-		if app.APIKey == apiKey {
-			return app, nil
-		}
+	ref, found := m.keyIndex[hash]
+	if !found || subtle.ConstantTimeCompare([]byte(ref.key.Hash), []byte(hash)) != 1 || !ref.key.Active(time.Now()) {
+		return nil, APIKey{}, fmt.Errorf("invalid API key")
+	}
+	app, exists := m.data.Apps[ref.appID]
+	if !exists {
+		return nil, APIKey{}, fmt.Errorf("invalid API key")
 	}
 
-	return nil, fmt.Errorf("invalid API key")
+	return app, *ref.key, nil
+}
+
+// GetApp returns the app with the given ID.
+func (m *Manager) GetApp(appID string) (*App, bool) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	app, exists := m.data.Apps[appID]
+	return app, exists
 }
 
 func (m *Manager) ListApps() []*App {
@@ -221,6 +411,18 @@ func (m *Manager) ListApps() []*App {
 	return apps
 }
 
+// public returns a copy of the app safe to send to clients.
+func (a *App) public() App {
+	copied := *a
+	copied.Tombstones = nil
+	copied.PendingErasures = nil
+	copied.Keys = make([]*APIKey, len(a.Keys))
+	for i, key := range a.Keys {
+		copied.Keys[i] = key.public()
+	}
+	return copied
+}
+
 func GenerateUUIDv7() (string, error) {
 	uuid, err := uuid.NewV7()
 	if err != nil {
@@ -0,0 +1,279 @@
+package apps
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Role is the access level of an org member. Each role includes the ones below it.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"  // manages members and deletes apps
+	RoleAdmin  Role = "admin"  // creates apps, changes their settings and keys
+	RoleViewer Role = "viewer" // reads apps and their events
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Allows reports whether r grants at least the access of required.
+func (r Role) Allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// Org is a team sharing apps.
+type Org struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Members   []*Member `json:"members"`
+}
+
+// Member is a user of an org. Members invited by email have no UserID
+// until they sign in with a verified Firebase account for that email.
+type Member struct {
+	UserID  string    `json:"user_id,omitempty"`
+	Email   string    `json:"email,omitempty"`
+	Role    Role      `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// identity is the signed-in Firebase user of a request.
+type identity struct {
+	UserID string
+	Email  string // verified email, may be empty
+}
+
+// member returns the member matching user, or nil.
+func (o *Org) member(user identity) *Member {
+	for _, member := range o.Members {
+		if member.UserID != "" && member.UserID == user.UserID {
+			return member
+		}
+	}
+	if user.Email == "" {
+		return nil
+	}
+	for _, member := range o.Members {
+		if member.UserID == "" && strings.EqualFold(member.Email, user.Email) {
+			return member
+		}
+	}
+	return nil
+}
+
+// owners returns the number of members with the owner role.
+func (o *Org) owners() int {
+	n := 0
+	for _, member := range o.Members {
+		if member.Role == RoleOwner {
+			n++
+		}
+	}
+	return n
+}
+
+// personalOrgID returns the ID of the org holding a user's apps by default.
+func personalOrgID(userID string) string {
+	return "personal-" + userID
+}
+
+// roleFor returns the role of user in the app's org, or "" without access.
+// The caller must hold dataMu.
+func (m *Manager) roleFor(user identity, app *App) Role {
+	org, exists := m.data.Orgs[app.OrgID]
+	if !exists {
+		return ""
+	}
+	member := org.member(user)
+	if member == nil {
+		return ""
+	}
+	return member.Role
+}
+
+// roleInOrg returns the role of user in an org, or "" if the org does not
+// exist or the user is not a member.
+func (m *Manager) roleInOrg(user identity, orgID string) Role {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	org, exists := m.data.Orgs[orgID]
+	if !exists {
+		return ""
+	}
+	if member := org.member(user); member != nil {
+		return member.Role
+	}
+	return ""
+}
+
+// ensurePersonalOrg returns the personal org of userID, creating it if needed.
+// The caller must hold the dataMu write lock and save.
+func (m *Manager) ensurePersonalOrg(userID string) *Org {
+	id := personalOrgID(userID)
+	if org, exists := m.data.Orgs[id]; exists {
+		return org
+	}
+
+	now := time.Now().UTC()
+	org := &Org{
+		ID:        id,
+		Name:      "Personal",
+		CreatedAt: now,
+		Members:   []*Member{{UserID: userID, Role: RoleOwner, AddedAt: now}},
+	}
+	m.data.Orgs[id] = org
+	return org
+}
+
+// CreateOrg creates an org owned by userID.
+func (m *Manager) CreateOrg(name string, userID string) (*Org, error) {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	id, err := GenerateUUIDv7()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create org ID: %w", err)
+	}
+
+	now := time.Now().UTC()
+	org := &Org{
+		ID:        id,
+		Name:      name,
+		CreatedAt: now,
+		Members:   []*Member{{UserID: userID, Role: RoleOwner, AddedAt: now}},
+	}
+	m.data.Orgs[id] = org
+
+	if err := m.save(); err != nil {
+		delete(m.data.Orgs, id) // Rollback on save failure
+		return nil, fmt.Errorf("save org: %w", err)
+	}
+
+	return org, nil
+}
+
+// ListOrgs returns copies of the orgs user is a member of.
+func (m *Manager) ListOrgs(user identity) []Org {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	orgs := make([]Org, 0)
+	for _, org := range m.data.Orgs {
+		if org.member(user) != nil {
+			orgs = append(orgs, copyOrg(org))
+		}
+	}
+	return orgs
+}
+
+// GetOrg returns a copy of the org with the given ID.
+func (m *Manager) GetOrg(orgID string) (Org, bool) {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	org, exists := m.data.Orgs[orgID]
+	if !exists {
+		return Org{}, false
+	}
+	return copyOrg(org), true
+}
+
+// SetMember adds a member to an org, or changes the role of an existing one.
+// Members are identified by user ID, or by email for invitations.
+func (m *Manager) SetMember(orgID string, userID, email string, role Role) (*Member, error) {
+	if !role.Valid() {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+	if userID == "" && email == "" {
+		return nil, fmt.Errorf("user_id or email is required")
+	}
+
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	org, exists := m.data.Orgs[orgID]
+	if !exists {
+		return nil, fmt.Errorf("org %s not found", orgID)
+	}
+
+	member := org.member(identity{UserID: userID, Email: email})
+	added := member == nil
+	if added {
+		member = &Member{UserID: userID, Email: email, AddedAt: time.Now().UTC()}
+		org.Members = append(org.Members, member)
+	} else if member.Role == RoleOwner && role != RoleOwner && org.owners() == 1 {
+		return nil, fmt.Errorf("org must keep at least one owner")
+	}
+	previous := member.Role
+	member.Role = role
+
+	if err := m.save(); err != nil {
+		// Rollback on save failure
+		if added {
+			org.Members = org.Members[:len(org.Members)-1]
+		} else {
+			member.Role = previous
+		}
+		return nil, fmt.Errorf("save org: %w", err)
+	}
+
+	copied := *member
+	return &copied, nil
+}
+
+// RemoveMember removes the member with the given user ID or email from an org.
+func (m *Manager) RemoveMember(orgID string, userIDOrEmail string) error {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	org, exists := m.data.Orgs[orgID]
+	if !exists {
+		return fmt.Errorf("org %s not found", orgID)
+	}
+
+	member := org.member(identity{UserID: userIDOrEmail, Email: userIDOrEmail})
+	if member == nil {
+		return fmt.Errorf("member %s not found", userIDOrEmail)
+	}
+	if member.Role == RoleOwner && org.owners() == 1 {
+		return fmt.Errorf("org must keep at least one owner")
+	}
+
+	members := org.Members
+	org.Members = make([]*Member, 0, len(members)-1)
+	for _, other := range members {
+		if other != member {
+			org.Members = append(org.Members, other)
+		}
+	}
+
+	if err := m.save(); err != nil {
+		org.Members = members // Rollback on save failure
+		return fmt.Errorf("save org: %w", err)
+	}
+
+	return nil
+}
+
+func copyOrg(org *Org) Org {
+	copied := *org
+	copied.Members = make([]*Member, len(org.Members))
+	for i, member := range org.Members {
+		m := *member
+		copied.Members[i] = &m
+	}
+	return copied
+}
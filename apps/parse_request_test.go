@@ -1,6 +1,7 @@
 package apps
 
 import (
+	"analytics/models"
 	"net/http/httptest"
 	"testing"
 	"time"
@@ -67,7 +68,7 @@ func TestParseRequest(t *testing.T) {
 			}
 			req.URL.RawQuery = q.Encode()
 
-			appID, startMinutes, err := manager.parseRequest(req)
+			query, err := manager.parseRequest(req)
 
 			if tt.expectError {
 				if err == nil {
@@ -81,9 +82,10 @@ func TestParseRequest(t *testing.T) {
 				return
 			}
 
-			if appID != tt.expectAppID {
-				t.Errorf("Expected appID %s, got %s", tt.expectAppID, appID)
+			if query.AppID != tt.expectAppID {
+				t.Errorf("Expected appID %s, got %s", tt.expectAppID, query.AppID)
 			}
+			startMinutes := query.StartMinutes
 
 			// For default time, allow some tolerance (test execution time)
 			if tt.queryParams["start-minutes-since-epoch"] == "" {
@@ -99,3 +101,84 @@ func TestParseRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRequestPagination(t *testing.T) {
+	manager := &Manager{}
+	cursor := encodeCursor(models.Event{EventID: "e1", Timestamp: time.Unix(60000, 0)})
+
+	tests := []struct {
+		name        string
+		queryParams map[string]string
+		expectEnd   int64
+		expectLimit int
+		expectError bool
+	}{
+		{
+			name:        "end and limit",
+			queryParams: map[string]string{"start-minutes-since-epoch": "1000", "end-minutes-since-epoch": "2000", "limit": "50"},
+			expectEnd:   2000,
+			expectLimit: 50,
+		},
+		{
+			name:        "cursor",
+			queryParams: map[string]string{"start-minutes-since-epoch": "1000", "cursor": cursor},
+		},
+		{
+			name:        "end before start",
+			queryParams: map[string]string{"start-minutes-since-epoch": "1000", "end-minutes-since-epoch": "1000"},
+			expectError: true,
+		},
+		{
+			name:        "invalid end format",
+			queryParams: map[string]string{"end-minutes-since-epoch": "soon"},
+			expectError: true,
+		},
+		{
+			name:        "zero limit",
+			queryParams: map[string]string{"limit": "0"},
+			expectError: true,
+		},
+		{
+			name:        "limit above maximum",
+			queryParams: map[string]string{"limit": "10001"},
+			expectError: true,
+		},
+		{
+			name:        "invalid cursor",
+			queryParams: map[string]string{"cursor": "%%%"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/analytics/api/v1/apps/test123/events", nil)
+			q := req.URL.Query()
+			for key, value := range tt.queryParams {
+				q.Add(key, value)
+			}
+			req.URL.RawQuery = q.Encode()
+
+			query, err := manager.parseRequest(req)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if query.EndMinutes != tt.expectEnd {
+				t.Errorf("Expected end %d, got %d", tt.expectEnd, query.EndMinutes)
+			}
+			if query.Limit != tt.expectLimit {
+				t.Errorf("Expected limit %d, got %d", tt.expectLimit, query.Limit)
+			}
+			if tt.queryParams["cursor"] != "" && (query.Cursor == nil || query.Cursor.EventID != "e1") {
+				t.Errorf("Expected cursor for e1, got %+v", query.Cursor)
+			}
+		})
+	}
+}
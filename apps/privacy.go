@@ -0,0 +1,108 @@
+package apps
+
+import (
+	"fmt"
+)
+
+// IPMode is how the client IP of an app's events is stored.
+type IPMode string
+
+const (
+	IPModeFull     IPMode = "full"     // stored as received (default)
+	IPModeTruncate IPMode = "truncate" // host bits zeroed beyond the app's prefix lengths
+	IPModeHash     IPMode = "hash"     // keyed hash with a salt rotated daily, so it only links events of one day
+	IPModeDrop     IPMode = "drop"     // removed after the GeoIP lookup
+)
+
+// Default prefix lengths kept by IPModeTruncate.
+const (
+	DefaultIPv4Prefix = 24
+	DefaultIPv6Prefix = 48
+)
+
+// Privacy holds the privacy settings of an app.
+type Privacy struct {
+	IPMode     IPMode `json:"ip_mode,omitempty"`
+	IPv4Prefix *int   `json:"ipv4_prefix,omitempty"` // bits kept by IPModeTruncate, default 24
+	IPv6Prefix *int   `json:"ipv6_prefix,omitempty"` // bits kept by IPModeTruncate, default 48
+
+	// CookielessVisitors derives the anonymous ID of events sent without one from the
+	// client IP and user agent, hashed with a daily salt. Visitors can then be counted
+	// within a day but not followed across days.
+	CookielessVisitors bool `json:"cookieless_visitors,omitempty"`
+
+	// NoStringSamples keeps string property values out of the event catalogue,
+	// for apps whose properties may hold personal data that redaction misses.
+	NoStringSamples bool `json:"no_string_samples,omitempty"`
+}
+
+// Validate checks the mode and prefix lengths.
+func (p Privacy) Validate() error {
+	switch p.IPMode {
+	case "", IPModeFull, IPModeTruncate, IPModeHash, IPModeDrop:
+	default:
+		return fmt.Errorf("invalid IP mode %q", p.IPMode)
+	}
+	if p.IPv4Prefix != nil && (*p.IPv4Prefix < 0 || *p.IPv4Prefix > 32) {
+		return fmt.Errorf("ipv4_prefix must be between 0 and 32")
+	}
+	if p.IPv6Prefix != nil && (*p.IPv6Prefix < 0 || *p.IPv6Prefix > 128) {
+		return fmt.Errorf("ipv6_prefix must be between 0 and 128")
+	}
+	return nil
+}
+
+// withDefaults fills the unset fields.
+func (p Privacy) withDefaults() Privacy {
+	if p.IPMode == "" {
+		p.IPMode = IPModeFull
+	}
+	if p.IPv4Prefix == nil {
+		prefix := DefaultIPv4Prefix
+		p.IPv4Prefix = &prefix
+	}
+	if p.IPv6Prefix == nil {
+		prefix := DefaultIPv6Prefix
+		p.IPv6Prefix = &prefix
+	}
+	return p
+}
+
+// Privacy returns the privacy settings of an app, with defaults filled in.
+func (m *Manager) Privacy(appID string) Privacy {
+	m.dataMu.RLock()
+	defer m.dataMu.RUnlock()
+
+	var privacy Privacy
+	if app, exists := m.data.Apps[appID]; exists {
+		privacy = app.Privacy
+	}
+	return privacy.withDefaults()
+}
+
+// SetPrivacy changes the privacy settings of an app.
+func (m *Manager) SetPrivacy(appID string, privacy Privacy) error {
+	if err := privacy.Validate(); err != nil {
+		return err
+	}
+
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return fmt.Errorf("app %s not found", appID)
+	}
+
+	previous := app.Privacy
+	app.Privacy = privacy
+	if err := m.save(); err != nil {
+		app.Privacy = previous // Rollback on save failure
+		return fmt.Errorf("save privacy: %w", err)
+	}
+	if privacy.NoStringSamples && !previous.NoStringSamples {
+		// Samples are collected again from new events, without strings
+		m.catalog.clearSamples(appID)
+	}
+	return nil
+}
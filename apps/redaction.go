@@ -0,0 +1,379 @@
+package apps
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"analytics/models"
+)
+
+// Detector is a built-in redaction rule finding one kind of personal data.
+type Detector string
+
+const (
+	DetectorEmail      Detector = "email"
+	DetectorPhone      Detector = "phone"       // 7 to 15 digits, written with a leading + or separators
+	DetectorCreditCard Detector = "credit_card" // 13 to 19 digits passing the Luhn check
+)
+
+// Counter names of the rules that are not detectors or patterns.
+const (
+	RedactionDeniedKey  = "denied_key"
+	RedactionQueryParam = "query_param"
+)
+
+// Redacted replaces the text matched by a redaction rule.
+const Redacted = "[REDACTED]"
+
+// RedactionPattern is a custom redaction rule. Its name identifies it in the usage counters.
+type RedactionPattern struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"` // Go regular expression
+}
+
+// Redaction holds the rules scrubbing personal data from an app's events before
+// they are cached or stored. Detectors and patterns replace what they match in
+// the string values of properties and in page_url and referrer; denied keys
+// remove properties at any depth; query parameters are removed from page_url
+// and referrer.
+type Redaction struct {
+	Detectors   []Detector         `json:"detectors,omitempty"`
+	Patterns    []RedactionPattern `json:"patterns,omitempty"`
+	DeniedKeys  []string           `json:"denied_keys,omitempty"`  // property keys, case-insensitive
+	QueryParams []string           `json:"query_params,omitempty"` // parameter names, case-insensitive; "*" removes the whole query
+}
+
+// Validate checks the detectors and compiles the patterns.
+func (r Redaction) Validate() error {
+	_, err := r.compile()
+	return err
+}
+
+// IsZero reports whether there are no rules.
+func (r Redaction) IsZero() bool {
+	return len(r.Detectors) == 0 && len(r.Patterns) == 0 && len(r.DeniedKeys) == 0 && len(r.QueryParams) == 0
+}
+
+// clone returns a copy not sharing slices with r.
+func (r Redaction) clone() Redaction {
+	r.Detectors = slices.Clone(r.Detectors)
+	r.Patterns = slices.Clone(r.Patterns)
+	r.DeniedKeys = slices.Clone(r.DeniedKeys)
+	r.QueryParams = slices.Clone(r.QueryParams)
+	return r
+}
+
+// replaceRule is a detector or pattern. A match is only replaced if check,
+// when set, accepts it.
+type replaceRule struct {
+	name  string
+	re    *regexp.Regexp
+	check func(match string) bool
+}
+
+var detectorRules = map[Detector]replaceRule{
+	DetectorEmail: {
+		name: string(DetectorEmail),
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	},
+	DetectorCreditCard: {
+		name:  string(DetectorCreditCard),
+		re:    regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+		check: luhnValid,
+	},
+	DetectorPhone: {
+		name:  string(DetectorPhone),
+		re:    regexp.MustCompile(`\+?\(?\d[\d\s().\-]{5,}\d`),
+		check: phoneLike,
+	},
+}
+
+// detectorOrder applies card numbers before phone numbers, which they would also match.
+var detectorOrder = []Detector{DetectorEmail, DetectorCreditCard, DetectorPhone}
+
+// redactor is the compiled form of a Redaction.
+type redactor struct {
+	rules       []replaceRule
+	deniedKeys  map[string]bool
+	queryParams map[string]bool
+	stripQuery  bool
+}
+
+func (r Redaction) compile() (*redactor, error) {
+	compiled := &redactor{
+		deniedKeys:  make(map[string]bool),
+		queryParams: make(map[string]bool),
+	}
+
+	for _, detector := range r.Detectors {
+		if _, ok := detectorRules[detector]; !ok {
+			return nil, fmt.Errorf("unknown detector %q", detector)
+		}
+	}
+	for _, detector := range detectorOrder {
+		if slices.Contains(r.Detectors, detector) {
+			compiled.rules = append(compiled.rules, detectorRules[detector])
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, pattern := range r.Patterns {
+		if pattern.Name == "" {
+			return nil, fmt.Errorf("pattern name is required")
+		}
+		if names[pattern.Name] {
+			return nil, fmt.Errorf("duplicate pattern name %q", pattern.Name)
+		}
+		names[pattern.Name] = true
+		re, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern.Name, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("pattern %q matches the empty string", pattern.Name)
+		}
+		compiled.rules = append(compiled.rules, replaceRule{name: pattern.Name, re: re})
+	}
+
+	for _, key := range r.DeniedKeys {
+		compiled.deniedKeys[strings.ToLower(key)] = true
+	}
+	for _, param := range r.QueryParams {
+		if param == "*" {
+			compiled.stripQuery = true
+		}
+		compiled.queryParams[strings.ToLower(param)] = true
+	}
+	return compiled, nil
+}
+
+// redact scrubs an event in place and returns how often each rule fired.
+func (c *redactor) redact(event *models.Event) map[string]int64 {
+	fired := make(map[string]int64)
+	if event.Properties != nil {
+		event.Properties = c.redactValue(event.Properties, fired).(map[string]interface{})
+	}
+	if event.Web != nil {
+		event.Web.PageURL = c.redactURL(event.Web.PageURL, fired)
+		event.Web.Referrer = c.redactURL(event.Web.Referrer, fired)
+	}
+	return fired
+}
+
+func (c *redactor) redactValue(value interface{}, fired map[string]int64) interface{} {
+	switch v := value.(type) {
+	case string:
+		return c.redactString(v, fired)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = c.redactValue(item, fired)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			if c.deniedKeys[strings.ToLower(key)] {
+				delete(v, key)
+				fired[RedactionDeniedKey]++
+				continue
+			}
+			v[key] = c.redactValue(item, fired)
+		}
+	}
+	return value
+}
+
+func (c *redactor) redactString(s string, fired map[string]int64) string {
+	for _, rule := range c.rules {
+		s = rule.re.ReplaceAllStringFunc(s, func(match string) string {
+			if rule.check != nil && !rule.check(match) {
+				return match
+			}
+			fired[rule.name]++
+			return Redacted
+		})
+	}
+	return s
+}
+
+// redactURL removes the denied query parameters of a URL and scrubs the values
+// of the others. The query is decoded first so that, for example, an email
+// written with %40 is still found. URLs that do not parse are scrubbed as text,
+// and URLs nothing fired on are returned unchanged.
+func (c *redactor) redactURL(raw string, fired map[string]int64) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return c.redactString(raw, fired)
+	}
+
+	changed := false
+	scrub := func(s string) string {
+		redacted := c.redactString(s, fired)
+		changed = changed || redacted != s
+		return redacted
+	}
+
+	u.Opaque = scrub(u.Opaque)
+	u.Path = scrub(u.Path)
+	u.Fragment = scrub(u.Fragment)
+	if u.RawQuery != "" {
+		query, err := url.ParseQuery(u.RawQuery)
+		switch {
+		case c.stripQuery:
+			u.RawQuery = ""
+			fired[RedactionQueryParam]++
+			changed = true
+		case err != nil:
+			u.RawQuery = scrub(u.RawQuery)
+		default:
+			queryChanged := false
+			for name, values := range query {
+				if c.queryParams[strings.ToLower(name)] {
+					query.Del(name)
+					fired[RedactionQueryParam]++
+					queryChanged = true
+					continue
+				}
+				for i, value := range values {
+					values[i] = scrub(value)
+					queryChanged = queryChanged || values[i] != value
+				}
+			}
+			if queryChanged {
+				u.RawQuery = query.Encode()
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return raw
+	}
+	u.RawPath, u.RawFragment = "", ""
+	return u.String()
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		d := int(s[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// phoneLike reports whether s has 7 to 15 digits and a leading + or a
+// separator, so that plain numbers such as IDs and timestamps are left alone.
+func phoneLike(s string) bool {
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return false
+	}
+	return strings.HasPrefix(s, "+") || strings.ContainsAny(s, " ().-")
+}
+
+// redactorCache holds the compiled redaction rules of each app, recompiled
+// when the rules change.
+type redactorCache struct {
+	mu    sync.Mutex
+	byApp map[string]cachedRedactor
+}
+
+type cachedRedactor struct {
+	rules    Redaction
+	redactor *redactor
+}
+
+func (rc *redactorCache) get(appID string, rules Redaction) (*redactor, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if cached, ok := rc.byApp[appID]; ok && reflect.DeepEqual(cached.rules, rules) {
+		return cached.redactor, nil
+	}
+	compiled, err := rules.compile()
+	if err != nil {
+		return nil, err
+	}
+	if rc.byApp == nil {
+		rc.byApp = make(map[string]cachedRedactor)
+	}
+	rc.byApp[appID] = cachedRedactor{rules: rules.clone(), redactor: compiled}
+	return compiled, nil
+}
+
+func (rc *redactorCache) forget(appID string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	delete(rc.byApp, appID)
+}
+
+// RedactEvent applies the redaction rules of an app to an event in place and
+// counts how often each rule fired in the app's usage. It fails if the rules do
+// not compile, so that the event is not kept unredacted.
+func (m *Manager) RedactEvent(appID string, event *models.Event) error {
+	m.dataMu.RLock()
+	var rules Redaction
+	if app, exists := m.data.Apps[appID]; exists {
+		rules = app.Redaction.clone()
+	}
+	m.dataMu.RUnlock()
+	if rules.IsZero() {
+		return nil
+	}
+
+	compiled, err := m.redactors.get(appID, rules)
+	if err != nil {
+		// Rules are validated when set, so only a hand-edited metadata file gets here
+		return fmt.Errorf("invalid redaction rules for app %s: %w", appID, err)
+	}
+	if fired := compiled.redact(event); len(fired) > 0 {
+		m.usage.recordRedactions(appID, fired, time.Now())
+	}
+	return nil
+}
+
+// SetRedaction changes the redaction rules of an app.
+func (m *Manager) SetRedaction(appID string, redaction Redaction) error {
+	if err := redaction.Validate(); err != nil {
+		return err
+	}
+
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return fmt.Errorf("app %s not found", appID)
+	}
+
+	previous := app.Redaction
+	app.Redaction = redaction
+	if err := m.save(); err != nil {
+		app.Redaction = previous // Rollback on save failure
+		return fmt.Errorf("save redaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package apps
+
+import (
+	"analytics/config"
+	"analytics/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactString(t *testing.T) {
+	compiled, err := Redaction{
+		Detectors: []Detector{DetectorEmail, DetectorPhone, DetectorCreditCard},
+		Patterns:  []RedactionPattern{{Name: "order", Pattern: `ORD-\d+`}},
+	}.compile()
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		fired    map[string]int64
+	}{
+		{"contact jane.doe@example.co.uk now", "contact [REDACTED] now", map[string]int64{"email": 1}},
+		{"call +44 20 7946 0958", "call [REDACTED]", map[string]int64{"phone": 1}},
+		{"call (555) 123-4567", "call [REDACTED]", map[string]int64{"phone": 1}},
+		{"card 4111 1111 1111 1111", "card [REDACTED]", map[string]int64{"credit_card": 1}},
+		{"card 4111 1111 1111 1112", "card 4111 1111 1111 1112", map[string]int64{}}, // fails Luhn, and too many digits for a phone
+		{"id 1700000000000", "id 1700000000000", map[string]int64{}},
+		{"see ORD-1234 and ORD-5", "see [REDACTED] and [REDACTED]", map[string]int64{"order": 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			fired := make(map[string]int64)
+			if got := compiled.redactString(tt.input, fired); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if !reflect.DeepEqual(fired, tt.fired) {
+				t.Errorf("Expected fired %v, got %v", tt.fired, fired)
+			}
+		})
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    Redaction
+		input    string
+		expected string
+	}{
+		{
+			name:     "encoded email in query",
+			rules:    Redaction{Detectors: []Detector{DetectorEmail}},
+			input:    "https://example.com/welcome?email=jane%40example.com&ref=ad",
+			expected: "https://example.com/welcome?email=%5BREDACTED%5D&ref=ad",
+		},
+		{
+			name:     "denied parameter",
+			rules:    Redaction{QueryParams: []string{"Token"}},
+			input:    "https://example.com/reset?token=abc&lang=en#top",
+			expected: "https://example.com/reset?lang=en#top",
+		},
+		{
+			name:     "whole query",
+			rules:    Redaction{QueryParams: []string{"*"}},
+			input:    "https://example.com/search?q=jane",
+			expected: "https://example.com/search",
+		},
+		{
+			name:     "untouched",
+			rules:    Redaction{Detectors: []Detector{DetectorEmail}, QueryParams: []string{"token"}},
+			input:    "https://example.com/a?b=c&a=d",
+			expected: "https://example.com/a?b=c&a=d",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := tt.rules.compile()
+			if err != nil {
+				t.Fatalf("Failed to compile rules: %v", err)
+			}
+			if got := compiled.redactURL(tt.input, make(map[string]int64)); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRedactionValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Redaction
+		valid bool
+	}{
+		{"empty", Redaction{}, true},
+		{"all detectors", Redaction{Detectors: []Detector{DetectorEmail, DetectorPhone, DetectorCreditCard}}, true},
+		{"unknown detector", Redaction{Detectors: []Detector{"ssn"}}, false},
+		{"unnamed pattern", Redaction{Patterns: []RedactionPattern{{Pattern: "x"}}}, false},
+		{"duplicate pattern", Redaction{Patterns: []RedactionPattern{{Name: "a", Pattern: "x"}, {Name: "a", Pattern: "y"}}}, false},
+		{"invalid pattern", Redaction{Patterns: []RedactionPattern{{Name: "a", Pattern: "("}}}, false},
+		{"empty match", Redaction{Patterns: []RedactionPattern{{Name: "a", Pattern: "x*"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rules.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got error %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestRedactEvent(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	app, _ := manager.CreateApp("redacted", nil, "alice", "")
+
+	// Rules are set through the update endpoint like the dashboard does
+	body := `{"name":"redacted","redaction":{"detectors":["email"],"denied_keys":["password"],"query_params":["token"]}}`
+	req := httptest.NewRequest(http.MethodPut, "/analytics/api/v1/apps/"+app.ID, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	manager.UpdateAppHandler()(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	event := &models.Event{
+		AppID:     app.ID,
+		Timestamp: time.Now(),
+		Properties: map[string]interface{}{
+			"note":     "from bob@example.com",
+			"Password": "hunter2",
+			"form":     map[string]interface{}{"password": "x", "emails": []interface{}{"a@b.io", 3.0}},
+		},
+		Web: &models.WebInfo{PageURL: "https://example.com/?token=secret&x=1"},
+	}
+	if err := manager.RedactEvent(app.ID, event); err != nil {
+		t.Fatalf("Failed to redact event: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"note": "from [REDACTED]",
+		"form": map[string]interface{}{"emails": []interface{}{"[REDACTED]", 3.0}},
+	}
+	if !reflect.DeepEqual(event.Properties, expected) {
+		t.Errorf("Expected properties %v, got %v", expected, event.Properties)
+	}
+	if event.Web.PageURL != "https://example.com/?x=1" {
+		t.Errorf("Expected token stripped from page URL, got %q", event.Web.PageURL)
+	}
+
+	days := manager.usage.month(app.ID, time.Now())
+	if len(days) != 1 {
+		t.Fatalf("Expected one day of usage, got %d", len(days))
+	}
+	if expected := map[string]int64{"email": 2, RedactionDeniedKey: 2, RedactionQueryParam: 1}; !reflect.DeepEqual(days[0].Redactions, expected) {
+		t.Errorf("Expected redaction counts %v, got %v", expected, days[0].Redactions)
+	}
+
+	// Invalid rules are refused
+	req = httptest.NewRequest(http.MethodPut, "/analytics/api/v1/apps/"+app.ID, strings.NewReader(`{"name":"redacted","redaction":{"detectors":["ssn"]}}`))
+	w = httptest.NewRecorder()
+	manager.UpdateAppHandler()(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown detector, got %d", w.Code)
+	}
+}
@@ -0,0 +1,448 @@
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"analytics/models"
+)
+
+// maxViolationsPerApp is how many recent schema violations are kept per app.
+const maxViolationsPerApp = 200
+
+// SchemaMode is what the tracker does with events that do not match an app's schema.
+type SchemaMode string
+
+const (
+	SchemaModeOff     SchemaMode = "off"     // no validation (default)
+	SchemaModeWarn    SchemaMode = "warn"    // accept, listing the violations on the event
+	SchemaModeEnforce SchemaMode = "enforce" // reject with 422
+)
+
+// Valid reports whether m is a known mode. The empty mode means SchemaModeOff.
+func (m SchemaMode) Valid() bool {
+	switch m {
+	case "", SchemaModeOff, SchemaModeWarn, SchemaModeEnforce:
+		return true
+	}
+	return false
+}
+
+// PropertyType is the JSON type of an event property.
+type PropertyType string
+
+const (
+	PropertyString  PropertyType = "string"
+	PropertyNumber  PropertyType = "number"
+	PropertyInteger PropertyType = "integer" // a number without fraction
+	PropertyBoolean PropertyType = "boolean"
+	PropertyObject  PropertyType = "object"
+	PropertyArray   PropertyType = "array"
+)
+
+// Valid reports whether t is a known type. The empty type allows any value.
+func (t PropertyType) Valid() bool {
+	switch t {
+	case "", PropertyString, PropertyNumber, PropertyInteger, PropertyBoolean, PropertyObject, PropertyArray:
+		return true
+	}
+	return false
+}
+
+// matches reports whether a decoded JSON value has the type.
+func (t PropertyType) matches(value interface{}) bool {
+	switch t {
+	case "":
+		return true
+	case PropertyString:
+		_, ok := value.(string)
+		return ok
+	case PropertyNumber:
+		_, ok := value.(float64)
+		return ok
+	case PropertyInteger:
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	case PropertyBoolean:
+		_, ok := value.(bool)
+		return ok
+	case PropertyObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case PropertyArray:
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+// PropertyDefinition describes one property of an event.
+type PropertyDefinition struct {
+	Type     PropertyType `json:"type,omitempty"`
+	Required bool         `json:"required,omitempty"`
+}
+
+// EventDefinition registers an event name and the properties it carries.
+type EventDefinition struct {
+	Name                 string                        `json:"name"`
+	Description          string                        `json:"description,omitempty"`
+	Properties           map[string]PropertyDefinition `json:"properties,omitempty"`
+	AllowOtherProperties bool                          `json:"allow_other_properties,omitempty"` // else unlisted properties are violations
+	UpdatedAt            time.Time                     `json:"updated_at"`
+}
+
+// EventSchema is the event registry of an app.
+type EventSchema struct {
+	Mode       SchemaMode                  `json:"mode,omitempty"`
+	EventTypes []string                    `json:"event_types,omitempty"` // allowed in addition to the built-in types
+	Events     map[string]*EventDefinition `json:"events,omitempty"`      // by name
+}
+
+// builtinEventTypes are always allowed.
+var builtinEventTypes = []string{
+	models.EventTypePageView,
+	models.EventTypeClick,
+	models.EventTypeSignup,
+	models.EventTypePurchase,
+	models.EventTypeCustom,
+}
+
+// validate returns why an event does not match the schema, or nil if it does.
+func (s *EventSchema) validate(event *models.Event) []string {
+	var reasons []string
+
+	if !slices.Contains(builtinEventTypes, event.EventType) && !slices.Contains(s.EventTypes, event.EventType) {
+		reasons = append(reasons, fmt.Sprintf("unknown event_type %q", event.EventType))
+	}
+
+	definition, exists := s.Events[event.EventName]
+	if !exists {
+		return append(reasons, fmt.Sprintf("unknown event_name %q", event.EventName))
+	}
+
+	names := make([]string, 0, len(definition.Properties))
+	for name := range definition.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property := definition.Properties[name]
+		value, present := event.Properties[name]
+		switch {
+		case !present && property.Required:
+			reasons = append(reasons, fmt.Sprintf("missing required property %q", name))
+		case present && !property.Type.matches(value):
+			reasons = append(reasons, fmt.Sprintf("property %q must be of type %s", name, property.Type))
+		}
+	}
+
+	if !definition.AllowOtherProperties {
+		var unknown []string
+		for name := range event.Properties {
+			if _, defined := definition.Properties[name]; !defined {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			reasons = append(reasons, fmt.Sprintf("unknown property %q", name))
+		}
+	}
+	return reasons
+}
+
+// SchemaViolation records an event that did not match its app's schema.
+type SchemaViolation struct {
+	Time      time.Time  `json:"time"`
+	EventID   string     `json:"event_id,omitempty"`
+	EventName string     `json:"event_name"`
+	EventType string     `json:"event_type"`
+	Reasons   []string   `json:"reasons"`
+	Mode      SchemaMode `json:"mode"` // enforce if the event was rejected
+}
+
+// violationLog keeps the most recent schema violations of each app in memory.
+type violationLog struct {
+	mu   sync.Mutex
+	apps map[string][]SchemaViolation // appID -> violations, oldest first
+}
+
+func (l *violationLog) add(appID string, v SchemaViolation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.apps == nil {
+		l.apps = make(map[string][]SchemaViolation)
+	}
+	violations := append(l.apps[appID], v)
+	if len(violations) > maxViolationsPerApp {
+		violations = violations[len(violations)-maxViolationsPerApp:]
+	}
+	l.apps[appID] = violations
+}
+
+// recent returns the violations of an app, newest first.
+func (l *violationLog) recent(appID string) []SchemaViolation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stored := l.apps[appID]
+	violations := make([]SchemaViolation, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		violations = append(violations, stored[i])
+	}
+	return violations
+}
+
+func (l *violationLog) forget(appID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.apps, appID)
+}
+
+// ValidateEvent checks an event against the schema of its app. It returns the
+// app's schema mode and the violations, which are also recorded for
+// SchemaViolationsHandler. With SchemaModeOff nothing is checked.
+func (m *Manager) ValidateEvent(appID string, event *models.Event) (SchemaMode, []string) {
+	m.dataMu.RLock()
+	app, exists := m.data.Apps[appID]
+	if !exists || app.Schema.Mode == "" || app.Schema.Mode == SchemaModeOff {
+		m.dataMu.RUnlock()
+		return SchemaModeOff, nil
+	}
+	mode := app.Schema.Mode
+	reasons := app.Schema.validate(event)
+	m.dataMu.RUnlock()
+
+	if len(reasons) > 0 {
+		m.violations.add(appID, SchemaViolation{
+			Time:      time.Now().UTC(),
+			EventID:   event.EventID,
+			EventName: event.EventName,
+			EventType: event.EventType,
+			Reasons:   reasons,
+			Mode:      mode,
+		})
+	}
+	return mode, reasons
+}
+
+// SetSchemaSettings changes the validation mode and extra event types of an app.
+func (m *Manager) SetSchemaSettings(appID string, mode SchemaMode, eventTypes []string) error {
+	if !mode.Valid() {
+		return fmt.Errorf("invalid schema mode %q", mode)
+	}
+
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return fmt.Errorf("app %s not found", appID)
+	}
+
+	previousMode, previousTypes := app.Schema.Mode, app.Schema.EventTypes
+	app.Schema.Mode, app.Schema.EventTypes = mode, eventTypes
+	if err := m.save(); err != nil {
+		app.Schema.Mode, app.Schema.EventTypes = previousMode, previousTypes // Rollback on save failure
+		return fmt.Errorf("save schema: %w", err)
+	}
+	return nil
+}
+
+// PutEventDefinition adds or replaces an event definition of an app.
+func (m *Manager) PutEventDefinition(appID string, definition EventDefinition) (*EventDefinition, error) {
+	if definition.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	for name, property := range definition.Properties {
+		if !property.Type.Valid() {
+			return nil, fmt.Errorf("invalid type %q of property %q", property.Type, name)
+		}
+	}
+
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return nil, fmt.Errorf("app %s not found", appID)
+	}
+	if app.Schema.Events == nil {
+		app.Schema.Events = make(map[string]*EventDefinition)
+	}
+
+	definition.UpdatedAt = time.Now().UTC()
+	previous, existed := app.Schema.Events[definition.Name]
+	app.Schema.Events[definition.Name] = &definition
+	if err := m.save(); err != nil {
+		// Rollback on save failure
+		if existed {
+			app.Schema.Events[definition.Name] = previous
+		} else {
+			delete(app.Schema.Events, definition.Name)
+		}
+		return nil, fmt.Errorf("save event definition: %w", err)
+	}
+	return &definition, nil
+}
+
+// DeleteEventDefinition removes an event definition of an app.
+func (m *Manager) DeleteEventDefinition(appID, name string) error {
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return fmt.Errorf("app %s not found", appID)
+	}
+	previous, exists := app.Schema.Events[name]
+	if !exists {
+		return fmt.Errorf("event definition %s not found", name)
+	}
+
+	delete(app.Schema.Events, name)
+	if err := m.save(); err != nil {
+		app.Schema.Events[name] = previous // Rollback on save failure
+		return fmt.Errorf("save event definition: %w", err)
+	}
+	return nil
+}
+
+// isDefinitionsPath reports whether a request path is under /apps/<id>/event-definitions.
+func isDefinitionsPath(path string) bool {
+	sub := appSubPath(path)
+	return sub == "event-definitions" || strings.HasPrefix(sub, "event-definitions/")
+}
+
+// EventDefinitionsHandler manages the event schema of an app; CrudHandler has
+// already checked that the user is a viewer, or an admin for changes.
+//   - GET /apps/<id>/event-definitions: the schema, with definitions sorted by name
+//   - PUT /apps/<id>/event-definitions: set {"mode", "event_types"}; mode is off, warn or enforce
+//   - PUT /apps/<id>/event-definitions/<name>: add or replace a definition
+//     {"description", "properties": {"<name>": {"type", "required"}}, "allow_other_properties"}
+//   - DELETE /apps/<id>/event-definitions/<name>: remove a definition
+func (m *Manager) EventDefinitionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("EventDefinitionsHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		appID, err := extractAppID(r.URL.Path)
+		if err != nil {
+			http.Error(w, "invalid app ID", http.StatusBadRequest)
+			return
+		}
+		name := strings.Trim(strings.TrimPrefix(appSubPath(r.URL.Path), "event-definitions"), "/")
+
+		switch {
+		case r.Method == http.MethodGet && name == "":
+			app, exists := m.GetApp(appID)
+			if !exists {
+				http.Error(w, "App not found", http.StatusNotFound)
+				return
+			}
+
+			var resp struct {
+				Mode        SchemaMode        `json:"mode"`
+				EventTypes  []string          `json:"event_types"`
+				Definitions []EventDefinition `json:"definitions"`
+			}
+			m.dataMu.RLock()
+			resp.Mode = app.Schema.Mode
+			resp.EventTypes = append(append([]string(nil), builtinEventTypes...), app.Schema.EventTypes...)
+			resp.Definitions = make([]EventDefinition, 0, len(app.Schema.Events))
+			for _, definition := range app.Schema.Events {
+				resp.Definitions = append(resp.Definitions, *definition)
+			}
+			m.dataMu.RUnlock()
+			if resp.Mode == "" {
+				resp.Mode = SchemaModeOff
+			}
+			sort.Slice(resp.Definitions, func(i, j int) bool { return resp.Definitions[i].Name < resp.Definitions[j].Name })
+			writeJSON(w, "EventDefinitionsHandler", http.StatusOK, resp)
+
+		case r.Method == http.MethodPut && name == "":
+			var req struct {
+				Mode       SchemaMode `json:"mode"`
+				EventTypes []string   `json:"event_types"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				log.Printf("EventDefinitionsHandler: Invalid request body: %v", err)
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if !req.Mode.Valid() {
+				http.Error(w, fmt.Sprintf("invalid mode %q, expected off, warn or enforce", req.Mode), http.StatusBadRequest)
+				return
+			}
+
+			if err := m.SetSchemaSettings(appID, req.Mode, req.EventTypes); err != nil {
+				log.Printf("EventDefinitionsHandler: Failed to set schema settings: %v", err)
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			log.Printf("EventDefinitionsHandler: Set schema mode %q of app %s", req.Mode, appID)
+
+		case r.Method == http.MethodPut && name != "":
+			var definition EventDefinition
+			if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+				log.Printf("EventDefinitionsHandler: Invalid request body: %v", err)
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			definition.Name = name
+			for property, def := range definition.Properties {
+				if !def.Type.Valid() {
+					http.Error(w, fmt.Sprintf("invalid type %q of property %q", def.Type, property), http.StatusBadRequest)
+					return
+				}
+			}
+
+			saved, err := m.PutEventDefinition(appID, definition)
+			if err != nil {
+				log.Printf("EventDefinitionsHandler: Failed to save definition: %v", err)
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			writeJSON(w, "EventDefinitionsHandler", http.StatusOK, saved)
+
+		case r.Method == http.MethodDelete && name != "":
+			if err := m.DeleteEventDefinition(appID, name); err != nil {
+				log.Printf("EventDefinitionsHandler: Failed to delete definition: %v", err)
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			log.Printf("EventDefinitionsHandler: Deleted definition %s of app %s", name, appID)
+
+		default:
+			http.Error(w, "Invalid path or method", http.StatusBadRequest)
+		}
+	}
+}
+
+// SchemaViolationsHandler returns the recent schema violations of an app, newest first.
+func (m *Manager) SchemaViolationsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("SchemaViolationsHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		appID, err := extractAppID(r.URL.Path)
+		if err != nil {
+			http.Error(w, "invalid app ID", http.StatusBadRequest)
+			return
+		}
+		if _, exists := m.GetApp(appID); !exists {
+			http.Error(w, "App not found", http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, "SchemaViolationsHandler", http.StatusOK, m.violations.recent(appID))
+	}
+}
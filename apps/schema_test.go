@@ -0,0 +1,119 @@
+package apps
+
+import (
+	"analytics/config"
+	"analytics/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEventSchemaValidate(t *testing.T) {
+	schema := EventSchema{
+		EventTypes: []string{"form_submit"},
+		Events: map[string]*EventDefinition{
+			"checkout": {
+				Name: "checkout",
+				Properties: map[string]PropertyDefinition{
+					"amount": {Type: PropertyNumber, Required: true},
+					"items":  {Type: PropertyInteger},
+				},
+			},
+			"signup": {Name: "signup", AllowOtherProperties: true},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		event    models.Event
+		expected []string
+	}{
+		{
+			name:  "valid",
+			event: models.Event{EventType: models.EventTypePurchase, EventName: "checkout", Properties: map[string]interface{}{"amount": 9.5, "items": 2.0}},
+		},
+		{
+			name:  "custom event type",
+			event: models.Event{EventType: "form_submit", EventName: "signup", Properties: map[string]interface{}{"anything": true}},
+		},
+		{
+			name:     "unknown name and type",
+			event:    models.Event{EventType: "clik", EventName: "chekout"},
+			expected: []string{`unknown event_type "clik"`, `unknown event_name "chekout"`},
+		},
+		{
+			name:  "property problems",
+			event: models.Event{EventType: models.EventTypePurchase, EventName: "checkout", Properties: map[string]interface{}{"items": 2.5, "coupon": "X"}},
+			expected: []string{
+				`missing required property "amount"`,
+				`property "items" must be of type integer`,
+				`unknown property "coupon"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schema.validate(&tt.event); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEventDefinitionsHandler(t *testing.T) {
+	manager := newTestManager(t, config.AppsConfig{})
+	org, _ := manager.CreateOrg("team", "alice")
+	manager.SetMember(org.ID, "bob", "", RoleViewer)
+	app, _ := manager.CreateApp("schema-app", nil, "alice", org.ID)
+
+	request := func(method, path, body, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/analytics/api/v1/apps/"+app.ID+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		manager.CrudHandler()(w, withUser(req, user))
+		return w
+	}
+
+	if w := request(http.MethodPut, "/event-definitions/checkout", `{"properties":{"amount":{"type":"number","required":true}}}`, "alice"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 adding definition, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodPut, "/event-definitions", `{"mode":"enforce"}`, "alice"); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 setting mode, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodPut, "/event-definitions/other", `{"properties":{"x":{"type":"text"}}}`, "alice"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown property type, got %d", w.Code)
+	}
+	if w := request(http.MethodPut, "/event-definitions/other", `{}`, "bob"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for viewer changing definitions, got %d", w.Code)
+	}
+
+	w := request(http.MethodGet, "/event-definitions", "", "bob")
+	var schema struct {
+		Mode        SchemaMode        `json:"mode"`
+		Definitions []EventDefinition `json:"definitions"`
+	}
+	json.NewDecoder(w.Body).Decode(&schema)
+	if schema.Mode != SchemaModeEnforce || len(schema.Definitions) != 1 || schema.Definitions[0].Name != "checkout" {
+		t.Errorf("Expected enforced schema with checkout, got %+v", schema)
+	}
+
+	// Violations are recorded and listed newest first
+	manager.ValidateEvent(app.ID, &models.Event{EventType: models.EventTypePurchase, EventName: "checkout"})
+	manager.ValidateEvent(app.ID, &models.Event{EventType: models.EventTypePurchase, EventName: "chekout"})
+	w = request(http.MethodGet, "/schema-violations", "", "bob")
+	var violations []SchemaViolation
+	json.NewDecoder(w.Body).Decode(&violations)
+	if len(violations) != 2 || violations[0].EventName != "chekout" || violations[1].Reasons[0] != `missing required property "amount"` {
+		t.Errorf("Expected two violations newest first, got %+v", violations)
+	}
+
+	if w := request(http.MethodDelete, "/event-definitions/checkout", "", "alice"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting definition, got %d", w.Code)
+	}
+	if w := request(http.MethodDelete, "/event-definitions/checkout", "", "alice"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting missing definition, got %d", w.Code)
+	}
+}
@@ -0,0 +1,221 @@
+package apps
+
+import (
+	"analytics/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBufferSize is the number of events queued per stream client. A client
+	// that falls this far behind is disconnected and resumes with Last-Event-ID.
+	streamBufferSize = 256
+
+	// streamHeartbeat is how often an idle stream sends a comment to keep proxies from closing it.
+	streamHeartbeat = 15 * time.Second
+
+	// streamRetryMillis is the reconnection delay suggested to EventSource clients.
+	streamRetryMillis = 3000
+)
+
+// subscriber is one live stream client of an app.
+type subscriber struct {
+	events chan models.Event
+	done   chan struct{} // closed when the client lags behind or the server shuts down
+	once   sync.Once
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// streamHub fans out new events to the live stream clients of each app.
+// Publishing never blocks: a client whose buffer is full is dropped instead
+// of slowing down ingestion. The zero value is ready to use.
+type streamHub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*subscriber]struct{} // appID -> subscribers
+}
+
+func (h *streamHub) subscribe(appID string) *subscriber {
+	sub := &subscriber{
+		events: make(chan models.Event, streamBufferSize),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[string]map[*subscriber]struct{})
+	}
+	if h.subs[appID] == nil {
+		h.subs[appID] = make(map[*subscriber]struct{})
+	}
+	h.subs[appID][sub] = struct{}{}
+	return sub
+}
+
+func (h *streamHub) unsubscribe(appID string, sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[appID], sub)
+	if len(h.subs[appID]) == 0 {
+		delete(h.subs, appID)
+	}
+	sub.close()
+}
+
+func (h *streamHub) publish(event *models.Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[event.AppID] {
+		select {
+		case sub.events <- *event:
+		default:
+			log.Printf("streamHub: Stream client for app %s fell behind, disconnecting", event.AppID)
+			sub.close()
+		}
+	}
+}
+
+// closeAll disconnects every stream client.
+func (h *streamHub) closeAll() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, subs := range h.subs {
+		for sub := range subs {
+			sub.close()
+		}
+	}
+}
+
+// CloseStreams disconnects all live stream clients so the server can shut down.
+func (m *Manager) CloseStreams() {
+	m.streams.closeAll()
+}
+
+// StreamEventsHandler streams new events of an app as Server-Sent Events.
+// Each event's SSE id is its cursor, so a reconnecting client sending Last-Event-ID
+// is first replayed the events it missed that are still in the cache window.
+// The repeatable filter parameter works as in GetEventsHandler.
+func (m *Manager) StreamEventsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("StreamEventsHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		appID, err := extractAppID(r.URL.Path)
+		if err != nil {
+			http.Error(w, "invalid app ID", http.StatusBadRequest)
+			return
+		}
+
+		filters, err := parseFilters(r.URL.Query()["filter"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var cursor *eventCursor
+		if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+			if cursor, err = decodeCursor(lastEventID); err != nil {
+				http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		// Subscribe before replaying so nothing published in between is missed.
+		sub := m.streams.subscribe(appID)
+		defer m.streams.unsubscribe(appID, sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // disable nginx/openresty response buffering
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+
+		replayed := make(map[string]bool)
+		if cursor != nil {
+			for _, event := range m.replayEvents(appID, cursor, filters) {
+				if err := writeStreamEvent(w, event); err != nil {
+					return
+				}
+				replayed[event.EventID] = true
+			}
+		}
+		flusher.Flush()
+		log.Printf("StreamEventsHandler: Client connected for app %s (replayed %d events)", appID, len(replayed))
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				log.Printf("StreamEventsHandler: Client disconnected for app %s", appID)
+				return
+			case <-sub.done:
+				log.Printf("StreamEventsHandler: Closing stream for app %s", appID)
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case event := <-sub.events:
+				if replayed[event.EventID] || !filters.matches(&event) {
+					continue
+				}
+				if err := writeStreamEvent(w, event); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// replayEvents returns the cached events after cursor that pass filters, in timestamp order.
+func (m *Manager) replayEvents(appID string, cursor *eventCursor, filters eventFilters) []models.Event {
+	m.cachesMu.RLock()
+	cache, exists := m.caches[appID]
+	m.cachesMu.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	events := make([]models.Event, 0)
+	for _, event := range cache.GetEventsSince(toMinutesSinceEpoch(cursor.time())) {
+		if cursor.after(event) && filters.matches(&event) {
+			events = append(events, event)
+		}
+	}
+	sortEvents(events)
+	return events
+}
+
+func writeStreamEvent(w http.ResponseWriter, event models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("StreamEventsHandler: Failed to encode event %s: %v", event.EventID, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", encodeCursor(event), data)
+	return err
+}
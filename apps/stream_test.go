@@ -0,0 +1,120 @@
+package apps
+
+import (
+	"analytics/models"
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamHubDropsSlowSubscriber(t *testing.T) {
+	var hub streamHub
+	sub := hub.subscribe("test-app")
+	defer hub.unsubscribe("test-app", sub)
+
+	// Publishing past the buffer must not block
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < streamBufferSize+10; i++ {
+			hub.publish(&models.Event{AppID: "test-app"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+
+	select {
+	case <-sub.done:
+	default:
+		t.Error("Expected slow subscriber to be disconnected")
+	}
+}
+
+// streamData returns a channel of the SSE data lines read from scanner.
+func streamData(scanner *bufio.Scanner) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				lines <- data
+			}
+		}
+	}()
+	return lines
+}
+
+// readStreamEvents reads data lines until n are seen or the timeout expires.
+func readStreamEvents(t *testing.T, lines <-chan string, n int) []string {
+	t.Helper()
+	got := make([]string, 0, n)
+	timeout := time.After(2 * time.Second)
+	for len(got) < n {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return got
+			}
+			got = append(got, line)
+		case <-timeout:
+			return got
+		}
+	}
+	return got
+}
+
+func TestStreamEventsHandler(t *testing.T) {
+	baseTime := time.Now().UTC()
+	manager := &Manager{caches: make(map[string]*EventCache)}
+
+	missed := &models.Event{EventID: "missed", AppID: "test-app", EventType: models.EventTypeClick, Timestamp: baseTime.Add(-time.Second)}
+	seen := &models.Event{EventID: "seen", AppID: "test-app", EventType: models.EventTypeClick, Timestamp: baseTime.Add(-2 * time.Second)}
+	manager.AddEvent(seen)
+	manager.AddEvent(missed)
+	manager.AddEvent(&models.Event{EventID: "view", AppID: "test-app", EventType: models.EventTypePageView, Timestamp: baseTime})
+	defer manager.caches["test-app"].Stop()
+
+	server := httptest.NewServer(manager.StreamEventsHandler())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		server.URL+"/analytics/api/v1/apps/test-app/events/stream?filter=event_type%3Dclick", nil)
+	req.Header.Set("Last-Event-ID", encodeCursor(*seen))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	lines := streamData(bufio.NewScanner(resp.Body))
+
+	// Replay from the cache: only the click after the Last-Event-ID
+	replayed := readStreamEvents(t, lines, 1)
+	if len(replayed) != 1 || !strings.Contains(replayed[0], `"event_id":"missed"`) {
+		t.Fatalf("Expected replay of missed event, got %v", replayed)
+	}
+
+	// Live events, filtered
+	manager.AddEvent(&models.Event{EventID: "live-view", AppID: "test-app", EventType: models.EventTypePageView, Timestamp: time.Now().UTC()})
+	manager.AddEvent(&models.Event{EventID: "live-click", AppID: "test-app", EventType: models.EventTypeClick, Timestamp: time.Now().UTC()})
+
+	live := readStreamEvents(t, lines, 1)
+	if len(live) != 1 || !strings.Contains(live[0], `"event_id":"live-click"`) {
+		t.Fatalf("Expected live-click, got %v", live)
+	}
+}
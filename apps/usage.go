@@ -0,0 +1,356 @@
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// usageFlushInterval is how often changed usage counters are written to disk.
+	usageFlushInterval = 10 * time.Second
+
+	// usageRetentionDays is how long daily usage is kept, enough for the previous month.
+	usageRetentionDays = 93
+
+	usageDayFormat = "20060102"
+)
+
+// Quotas limits the events an app can ingest per UTC day and month. Zero means unlimited.
+type Quotas struct {
+	Daily   int64 `json:"daily,omitempty"`
+	Monthly int64 `json:"monthly,omitempty"`
+}
+
+// Validate checks that the quotas are not negative.
+func (q Quotas) Validate() error {
+	if q.Daily < 0 || q.Monthly < 0 {
+		return fmt.Errorf("quotas must not be negative")
+	}
+	return nil
+}
+
+// DayUsage counts the events of an app received in one UTC day.
+type DayUsage struct {
+	Day           string `json:"day"` // YYYYMMDD
+	Accepted      int64  `json:"accepted"`
+	RateLimited   int64  `json:"rate_limited"`
+	QuotaExceeded int64  `json:"quota_exceeded"`
+
+	// Bots counts events classified as coming from bots by reason, whatever the app's bot policy.
+	Bots map[string]int64 `json:"bots,omitempty"`
+
+	// Redactions counts how often each redaction rule fired, see Redaction.
+	Redactions map[string]int64 `json:"redactions,omitempty"`
+}
+
+// usageLedger keeps the daily usage of every app, persisted to a JSON file.
+type usageLedger struct {
+	mu    sync.Mutex
+	path  string                          // "" keeps usage in memory only
+	days  map[string]map[string]*DayUsage // appID -> day -> usage
+	dirty bool
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newUsageLedger loads the ledger at path and starts flushing it periodically.
+func newUsageLedger(path string) (*usageLedger, error) {
+	u := &usageLedger{
+		path: path,
+		days: make(map[string]map[string]*DayUsage),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read usage: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &u.days); err != nil {
+				return nil, fmt.Errorf("parse usage: %w", err)
+			}
+		}
+	}
+
+	go u.flushLoop()
+	return u, nil
+}
+
+func (u *usageLedger) flushLoop() {
+	defer close(u.done)
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.stop:
+			return
+		case <-ticker.C:
+			if err := u.flush(); err != nil {
+				log.Printf("usageLedger: Failed to flush usage: %v", err)
+			}
+		}
+	}
+}
+
+// close stops the periodic flush and writes any pending changes.
+func (u *usageLedger) close() error {
+	close(u.stop)
+	<-u.done
+	return u.flush()
+}
+
+// flush writes the ledger if it changed, dropping days past retention.
+func (u *usageLedger) flush() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.dirty || u.path == "" {
+		return nil
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -usageRetentionDays).Format(usageDayFormat)
+	for appID, days := range u.days {
+		for day := range days {
+			if day < cutoff {
+				delete(days, day)
+			}
+		}
+		if len(days) == 0 {
+			delete(u.days, appID)
+		}
+	}
+
+	data, err := json.Marshal(u.days)
+	if err != nil {
+		return fmt.Errorf("marshal usage: %w", err)
+	}
+	tmp := u.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write usage: %w", err)
+	}
+	if err := os.Rename(tmp, u.path); err != nil {
+		return fmt.Errorf("write usage: %w", err)
+	}
+
+	u.dirty = false
+	return nil
+}
+
+// day returns the usage of an app on the day of now. The caller must hold mu.
+func (u *usageLedger) day(appID string, now time.Time) *DayUsage {
+	day := now.Format(usageDayFormat)
+	if u.days[appID] == nil {
+		u.days[appID] = make(map[string]*DayUsage)
+	}
+	usage, exists := u.days[appID][day]
+	if !exists {
+		usage = &DayUsage{Day: day}
+		u.days[appID][day] = usage
+	}
+	return usage
+}
+
+// monthAccepted returns the events accepted for an app in the month of now. The caller must hold mu.
+func (u *usageLedger) monthAccepted(appID string, now time.Time) int64 {
+	month := now.Format("200601")
+	var total int64
+	for day, usage := range u.days[appID] {
+		if strings.HasPrefix(day, month) {
+			total += usage.Accepted
+		}
+	}
+	return total
+}
+
+// reserve counts up to n events as accepted within quotas and the rest as over quota.
+// It returns how many were accepted and, if not all, how long until the quota resets.
+func (u *usageLedger) reserve(appID string, quotas Quotas, n int, now time.Time) (int, time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now = now.UTC()
+	today := u.day(appID, now)
+	granted := int64(n)
+	var retryAfter time.Duration
+
+	if quotas.Daily > 0 && today.Accepted+granted > quotas.Daily {
+		granted = max(0, quotas.Daily-today.Accepted)
+		retryAfter = now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+	}
+	if quotas.Monthly > 0 {
+		if used := u.monthAccepted(appID, now); used+granted > quotas.Monthly {
+			granted = max(0, quotas.Monthly-used)
+			nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			retryAfter = max(retryAfter, nextMonth.Sub(now))
+		}
+	}
+
+	today.Accepted += granted
+	today.QuotaExceeded += int64(n) - granted
+	u.dirty = true
+	return int(granted), retryAfter
+}
+
+// recordRateLimited counts n events of an app rejected by rate limiting.
+func (u *usageLedger) recordRateLimited(appID string, n int, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.day(appID, now.UTC()).RateLimited += int64(n)
+	u.dirty = true
+}
+
+// recordBot counts an event of an app classified as coming from a bot.
+func (u *usageLedger) recordBot(appID, reason string, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	usage := u.day(appID, now.UTC())
+	if usage.Bots == nil {
+		usage.Bots = make(map[string]int64)
+	}
+	usage.Bots[reason]++
+	u.dirty = true
+}
+
+// recordRedactions adds how often each redaction rule fired on an event of an app.
+func (u *usageLedger) recordRedactions(appID string, fired map[string]int64, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	usage := u.day(appID, now.UTC())
+	if usage.Redactions == nil {
+		usage.Redactions = make(map[string]int64)
+	}
+	for rule, n := range fired {
+		usage.Redactions[rule] += n
+	}
+	u.dirty = true
+}
+
+// month returns copies of an app's daily usage in the month of now, by day.
+func (u *usageLedger) month(appID string, now time.Time) []DayUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	month := now.UTC().Format("200601")
+	days := make([]DayUsage, 0)
+	for day, usage := range u.days[appID] {
+		if strings.HasPrefix(day, month) {
+			day := *usage
+			day.Bots = maps.Clone(usage.Bots)
+			day.Redactions = maps.Clone(usage.Redactions)
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days
+}
+
+// ReserveQuota counts up to n events of an app against its quotas. It returns
+// how many may be ingested and, when that is fewer than n, how long until the
+// exhausted quota resets. Reserved events count as used even if storing them fails.
+func (m *Manager) ReserveQuota(appID string, n int) (int, time.Duration) {
+	m.dataMu.RLock()
+	var quotas Quotas
+	if app, exists := m.data.Apps[appID]; exists {
+		quotas = app.Quotas
+	}
+	m.dataMu.RUnlock()
+
+	return m.usage.reserve(appID, quotas, n, time.Now())
+}
+
+// SetQuotas changes the quotas of an app.
+func (m *Manager) SetQuotas(appID string, quotas Quotas) error {
+	if err := quotas.Validate(); err != nil {
+		return err
+	}
+
+	m.dataMu.Lock()
+	defer m.dataMu.Unlock()
+
+	app, exists := m.data.Apps[appID]
+	if !exists {
+		return fmt.Errorf("app %s not found", appID)
+	}
+
+	previous := app.Quotas
+	app.Quotas = quotas
+	if err := m.save(); err != nil {
+		app.Quotas = previous // Rollback on save failure
+		return fmt.Errorf("save quotas: %w", err)
+	}
+	return nil
+}
+
+// RecordRateLimited counts n events of an app rejected by rate limiting.
+func (m *Manager) RecordRateLimited(appID string, n int) {
+	m.usage.recordRateLimited(appID, n, time.Now())
+}
+
+// UsageResponse is an app's ingestion usage in the current UTC month.
+type UsageResponse struct {
+	Quotas Quotas     `json:"quotas"`
+	Month  string     `json:"month"` // YYYYMM
+	Total  DayUsage   `json:"total"` // summed over the month, without a day
+	Days   []DayUsage `json:"days"`
+}
+
+// UsageHandler returns the usage of an app in the current month, so customers
+// can see when events were rejected for rate or quota limits.
+func (m *Manager) UsageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("UsageHandler: Received %s request for %s", r.Method, r.URL.Path)
+
+		appID, err := extractAppID(r.URL.Path)
+		if err != nil {
+			http.Error(w, "invalid app ID", http.StatusBadRequest)
+			return
+		}
+		app, exists := m.GetApp(appID)
+		if !exists {
+			http.Error(w, "App not found", http.StatusNotFound)
+			return
+		}
+
+		now := time.Now().UTC()
+		resp := UsageResponse{
+			Month: now.Format("200601"),
+			Days:  m.usage.month(appID, now),
+		}
+		m.dataMu.RLock()
+		resp.Quotas = app.Quotas
+		m.dataMu.RUnlock()
+		for _, day := range resp.Days {
+			resp.Total.Accepted += day.Accepted
+			resp.Total.RateLimited += day.RateLimited
+			resp.Total.QuotaExceeded += day.QuotaExceeded
+			for reason, n := range day.Bots {
+				if resp.Total.Bots == nil {
+					resp.Total.Bots = make(map[string]int64)
+				}
+				resp.Total.Bots[reason] += n
+			}
+			for rule, n := range day.Redactions {
+				if resp.Total.Redactions == nil {
+					resp.Total.Redactions = make(map[string]int64)
+				}
+				resp.Total.Redactions[rule] += n
+			}
+		}
+
+		writeJSON(w, "UsageHandler", http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,87 @@
+package apps
+
+import (
+	"analytics/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageLedgerReserve(t *testing.T) {
+	ledger, _ := newUsageLedger("")
+	defer ledger.close()
+	now := time.Date(2025, 8, 24, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		quotas          Quotas
+		n               int
+		at              time.Time
+		expectGranted   int
+		expectRetryFrom time.Duration // minimum Retry-After, 0 if all granted
+	}{
+		{"unlimited", Quotas{}, 5, now, 5, 0},
+		{"partly over daily quota", Quotas{Daily: 8}, 5, now, 3, 6 * time.Hour},
+		{"daily quota exhausted", Quotas{Daily: 8}, 1, now, 0, 6 * time.Hour},
+		{"next day", Quotas{Daily: 8}, 1, now.Add(24 * time.Hour), 1, 0},
+		{"monthly quota counts the whole month", Quotas{Monthly: 10}, 5, now.Add(24 * time.Hour), 1, 6 * 24 * time.Hour},
+		{"next month", Quotas{Monthly: 10}, 5, now.AddDate(0, 1, 0), 5, 0},
+	}
+
+	for _, tt := range tests {
+		granted, retryAfter := ledger.reserve("app", tt.quotas, tt.n, tt.at)
+		if granted != tt.expectGranted {
+			t.Errorf("%s: expected %d granted, got %d", tt.name, tt.expectGranted, granted)
+		}
+		if (tt.expectRetryFrom == 0) != (retryAfter == 0) || retryAfter < tt.expectRetryFrom {
+			t.Errorf("%s: expected Retry-After of at least %s, got %s", tt.name, tt.expectRetryFrom, retryAfter)
+		}
+	}
+
+	days := ledger.month("app", now)
+	if len(days) != 2 || days[0].Accepted != 8 || days[0].QuotaExceeded != 3 || days[1].Accepted != 2 || days[1].QuotaExceeded != 4 {
+		t.Errorf("Unexpected August usage: %+v", days)
+	}
+}
+
+func TestUsagePersistedAndReported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app-usage.json")
+	manager := newTestManager(t, config.AppsConfig{UsagePath: path})
+	app, _ := manager.CreateApp("usage-app", nil, "alice", "")
+	req := httptest.NewRequest(http.MethodPut, "/analytics/api/v1/apps/"+app.ID, strings.NewReader(`{"name":"usage-app","quotas":{"daily":-1}}`))
+	w := httptest.NewRecorder()
+	manager.UpdateAppHandler()(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative quota, got %d", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodPut, "/analytics/api/v1/apps/"+app.ID, strings.NewReader(`{"name":"usage-app","quotas":{"daily":100}}`))
+	w = httptest.NewRecorder()
+	manager.UpdateAppHandler()(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	manager.ReserveQuota(app.ID, 3)
+	manager.RecordRateLimited(app.ID, 2)
+
+	if err := manager.usage.close(); err != nil {
+		t.Fatalf("Failed to flush usage: %v", err)
+	}
+	manager.usage, _ = newUsageLedger(path)
+
+	req = httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps/"+app.ID+"/usage", nil)
+	w = httptest.NewRecorder()
+	manager.CrudHandler()(w, withUser(req, "alice"))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp UsageResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Quotas.Daily != 100 || resp.Total.Accepted != 3 || resp.Total.RateLimited != 2 || len(resp.Days) != 1 {
+		t.Errorf("Unexpected usage: %+v", resp)
+	}
+}
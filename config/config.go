@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Store backends
+const (
+	StoreBackendFS     = "fs"
+	StoreBackendSQLite = "sqlite"
+)
+
+// Config is the server configuration read from config.json.
+// Every field is optional; missing values fall back to Default().
+type Config struct {
+	Store  StoreConfig  `json:"store"`
+	Apps   AppsConfig   `json:"apps"`
+	Ingest IngestConfig `json:"ingest"`
+}
+
+// StoreConfig selects the event store backend.
+type StoreConfig struct {
+	Backend    string `json:"backend"`     // "fs" or "sqlite"
+	DataDir    string `json:"data_dir"`    // root of the fs backend
+	SQLitePath string `json:"sqlite_path"` // database file of the sqlite backend
+}
+
+// AppsConfig configures the app metadata manager.
+type AppsConfig struct {
+	// DefaultOwnerID is the Firebase user ID given to apps created before apps had owners.
+	// Unowned apps are inaccessible until it is set.
+	DefaultOwnerID string `json:"default_owner_id"`
+
+	// KeyGraceMinutes is how long the previous API keys of an app stay valid after a rotation.
+	KeyGraceMinutes int `json:"key_grace_minutes"`
+
+	// UsagePath is the file in which per-app ingestion usage is kept.
+	UsagePath string `json:"usage_path"`
+
+	// CatalogPath is the file in which the event names and properties seen per app are kept.
+	CatalogPath string `json:"catalog_path"`
+}
+
+// IngestConfig limits the rate of tracked events. A rate of 0 disables that limit.
+// Bursts are in events and should allow a full batch.
+type IngestConfig struct {
+	KeyRatePerSecond float64 `json:"key_rate_per_second"` // per API key
+	KeyBurst         int     `json:"key_burst"`
+	IPRatePerSecond  float64 `json:"ip_rate_per_second"` // per client IP
+	IPBurst          int     `json:"ip_burst"`
+
+	// DedupWindowMinutes is how long a client-supplied event_id is remembered per app,
+	// so a resent event is not stored twice. 0 disables deduplication.
+	DedupWindowMinutes int    `json:"dedup_window_minutes"`
+	DedupMaxEntries    int    `json:"dedup_max_entries"` // positive; oldest event IDs are forgotten first
+	DedupPath          string `json:"dedup_path"`        // journal of remembered event IDs
+
+	// GeoIPPath is a MaxMind-format city database (e.g. GeoLite2-City.mmdb) used to fill
+	// the location of events. It is reloaded when the file changes. Empty disables lookups.
+	GeoIPPath string `json:"geoip_path"`
+	// DropIP removes the client IP from events of every app once its location has been
+	// looked up. Apps can also choose this, or truncating or hashing, in their privacy settings.
+	DropIP bool `json:"drop_ip"`
+
+	// SaltPath is where the daily salt for hashed IPs is kept across restarts.
+	SaltPath string `json:"salt_path"`
+
+	// TrustedProxies are the CIDRs of reverse proxies in front of the server. Forwarding
+	// headers are only believed from them; other clients are identified by their connection.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// BotIPRanges are CIDRs, e.g. of datacenters, whose web events are classified as
+	// bot traffic, in addition to known crawler ranges.
+	BotIPRanges []string `json:"bot_ip_ranges"`
+}
+
+// Default returns the configuration used when no config file exists.
+func Default() *Config {
+	return &Config{
+		Store: StoreConfig{
+			Backend:    StoreBackendFS,
+			DataDir:    "data",
+			SQLitePath: "data/events.db",
+		},
+		Apps: AppsConfig{
+			KeyGraceMinutes: 24 * 60,
+			UsagePath:       "app-usage.json",
+			CatalogPath:     "app-catalog.json",
+		},
+		Ingest: IngestConfig{
+			KeyRatePerSecond: 200,
+			KeyBurst:         1000,
+			IPRatePerSecond:  50,
+			IPBurst:          500,
+
+			DedupWindowMinutes: 24 * 60,
+			DedupMaxEntries:    1_000_000,
+			DedupPath:          "data/dedup.log",
+			SaltPath:           "data/salt.json",
+			TrustedProxies:     []string{"127.0.0.1/32", "::1/128"},
+		},
+	}
+}
+
+// Load reads the config file at path over the defaults. A missing file is not an error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	switch cfg.Store.Backend {
+	case StoreBackendFS, StoreBackendSQLite:
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.Store.Backend)
+	}
+	if cfg.Apps.KeyGraceMinutes < 0 {
+		return nil, fmt.Errorf("key_grace_minutes must not be negative")
+	}
+	if cfg.Ingest.DedupWindowMinutes < 0 {
+		return nil, fmt.Errorf("dedup_window_minutes must not be negative")
+	}
+	if cfg.Ingest.DedupMaxEntries <= 0 {
+		return nil, fmt.Errorf("dedup_max_entries must be positive")
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"analytics/apps"
+	"analytics/store"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// runExport implements the export command, which writes the archive of
+// everything stored about a user of an app, as served by POST /apps/<id>/exports:
+//
+//	analytics export -app <id> [-user-id <id>] [-anonymous-id <id>] [-session-id <id>] [-o <file>]
+func runExport(events store.EventStore, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	appID := flags.String("app", "", "ID of the app")
+	var subject apps.Subject
+	flags.StringVar(&subject.UserID, "user-id", "", "user ID of the subject")
+	flags.StringVar(&subject.AnonymousID, "anonymous-id", "", "anonymous ID of the subject")
+	flags.StringVar(&subject.SessionID, "session-id", "", "session ID of the subject")
+	output := flags.String("o", "", "archive to write (default export-<app>.zip)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *appID == "" {
+		return fmt.Errorf("-app is required")
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("export-%s.zip", *appID)
+	}
+
+	export, err := apps.BuildExport(events, *appID, subject)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("create archive: %w", err)
+	}
+	if err := export.WriteZip(file); err != nil {
+		file.Close()
+		os.Remove(*output)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write archive: %w", err)
+	}
+
+	log.Printf("Exported %d events of app %s to %s", export.Summary.Events, *appID, *output)
+	return nil
+}
@@ -23,6 +23,7 @@ type FbProjectConfig map[string]string
 // TokenCacheEntry stores validated token info
 type TokenCacheEntry struct {
 	UserID string // e.g., "sub" claim
+	Email  string // "email" claim, only if verified
 }
 
 // JWKS represents the Firebase JWKS response structure
@@ -42,6 +43,9 @@ type ContextKey string
 // UserIDKey is the specific key for user ID
 const UserIDKey ContextKey = "userID"
 
+// EmailKey is the key for the user's verified email, absent if the token has none
+const EmailKey ContextKey = "email"
+
 // Global cache instance
 var (
 	tokenCache *cache.Cache
@@ -117,8 +121,7 @@ func FirebaseAuthMiddleware(next http.Handler) http.Handler {
 			if entry, ok := cached.(TokenCacheEntry); ok {
 				// log.Printf("Cache hit - Authenticated User ID: %s", entry.UserID)
 				// Add UID to request context
-				ctx := context.WithValue(r.Context(), UserIDKey, entry.UserID)
-				next.ServeHTTP(w, r.WithContext(ctx))
+				next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), entry)))
 				return
 			}
 		}
@@ -135,6 +138,10 @@ func FirebaseAuthMiddleware(next http.Handler) http.Handler {
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 			userID := claims["sub"].(string)
 			log.Printf("Authenticated User ID: %s (from Firebase)", userID)
+			entry := TokenCacheEntry{UserID: userID}
+			if verified, _ := claims["email_verified"].(bool); verified {
+				entry.Email, _ = claims["email"].(string)
+			}
 
 			// Get expiration time from token
 			if exp, ok := claims["exp"].(float64); ok {
@@ -142,17 +149,25 @@ func FirebaseAuthMiddleware(next http.Handler) http.Handler {
 				ttl := time.Until(expTime)
 				if ttl > 0 {
 					cacheMutex.Lock()
-					tokenCache.Set(tokenStr, TokenCacheEntry{UserID: userID}, ttl)
+					tokenCache.Set(tokenStr, entry, ttl)
 					cacheMutex.Unlock()
 				}
 			}
 			// Add UID to request context
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), entry)))
 		}
 	})
 }
 
+// withIdentity adds the user ID and, if known, the email of a token to ctx.
+func withIdentity(ctx context.Context, entry TokenCacheEntry) context.Context {
+	ctx = context.WithValue(ctx, UserIDKey, entry.UserID)
+	if entry.Email != "" {
+		ctx = context.WithValue(ctx, EmailKey, entry.Email)
+	}
+	return ctx
+}
+
 const JWKSURL = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
 
 // verifyFirebaseToken validates the JWT against Firebase public keys
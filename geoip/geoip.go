@@ -0,0 +1,171 @@
+// Package geoip resolves client IP addresses to locations using a local
+// MaxMind-format (MMDB) city database, such as GeoLite2-City.
+package geoip
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// reloadInterval is how often the database file is checked for changes.
+const reloadInterval = time.Minute
+
+// Location is the part of a city database record used for events.
+type Location struct {
+	Country string // ISO 3166-1 alpha-2 code, e.g. "GB"
+	Region  string // English name of the first subdivision, e.g. "England"
+	City    string // English name, e.g. "London"
+}
+
+// cityData is the part of a city database record decoded for a lookup.
+type cityData struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Locator looks up IP addresses in an MMDB file, reloading it when the file
+// changes. A nil *Locator finds nothing.
+type Locator struct {
+	path    string
+	mu      sync.RWMutex
+	db      *maxminddb.Reader // nil until a valid file has been loaded
+	modTime time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Open loads the database at path and starts watching it for changes. It returns
+// nil if path is empty. A missing file is not an error: lookups find nothing
+// until it appears. An invalid file is.
+func Open(path string) (*Locator, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	l := &Locator{
+		path: path,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+	if l.db == nil {
+		log.Printf("Locator: GeoIP database %s not found, waiting for it", path)
+	}
+
+	go l.watch()
+	return l, nil
+}
+
+func (l *Locator) watch() {
+	defer close(l.done)
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.reload(); err != nil {
+				log.Printf("Locator: Keeping previous GeoIP database: %v", err)
+			}
+		}
+	}
+}
+
+// reload loads the database file if its modification time changed.
+// On failure the previously loaded database stays in use.
+func (l *Locator) reload() error {
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stat GeoIP database: %w", err)
+	}
+
+	l.mu.RLock()
+	unchanged := l.db != nil && info.ModTime().Equal(l.modTime)
+	l.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	// Read into memory rather than mapped, so a replaced reader needs no closing
+	// while lookups may still use it
+	buf, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("read GeoIP database: %w", err)
+	}
+	db, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return fmt.Errorf("parse GeoIP database %s: %w", l.path, err)
+	}
+
+	l.mu.Lock()
+	l.db = db
+	l.modTime = info.ModTime()
+	l.mu.Unlock()
+
+	log.Printf("Locator: Loaded GeoIP database %s (%d nodes)", l.path, db.Metadata.NodeCount)
+	return nil
+}
+
+// Lookup returns the location of ip, or false if it is unknown.
+func (l *Locator) Lookup(ip net.IP) (Location, bool) {
+	if l == nil || ip == nil {
+		return Location{}, false
+	}
+
+	l.mu.RLock()
+	db := l.db
+	l.mu.RUnlock()
+	if db == nil {
+		return Location{}, false
+	}
+
+	// The reader reports IPv6 addresses in an IPv4 database as an error, not a miss
+	if ip.To4() == nil && db.Metadata.IPVersion == 4 {
+		return Location{}, false
+	}
+
+	var record cityData
+	if err := db.Lookup(ip, &record); err != nil {
+		log.Printf("Locator: %v", err)
+		return Location{}, false
+	}
+
+	loc := Location{
+		Country: record.Country.ISOCode,
+		City:    record.City.Names["en"],
+	}
+	if len(record.Subdivisions) > 0 {
+		loc.Region = record.Subdivisions[0].Names["en"]
+	}
+	return loc, loc != Location{}
+}
+
+// Close stops watching the database file.
+func (l *Locator) Close() error {
+	if l == nil {
+		return nil
+	}
+	close(l.stop)
+	<-l.done
+	return nil
+}
@@ -0,0 +1,161 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// metadataMarker precedes the metadata map at the end of an MMDB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree and the data section.
+const dataSectionSeparator = 16
+
+// Data section types used by encode
+const (
+	typeString = 2
+	typeUint16 = 5
+	typeUint32 = 6
+	typeMap    = 7
+	typeArray  = 11
+)
+
+// encode writes a value in the MMDB data section format, for building test databases.
+func encode(v any) []byte {
+	header := func(typ, size int) []byte {
+		if typ < 8 {
+			return []byte{byte(typ<<5 | size)}
+		}
+		return []byte{byte(size), byte(typ - 7)}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return append(header(typeString, len(v)), v...)
+	case uint16:
+		return append(header(typeUint16, 2), byte(v>>8), byte(v))
+	case uint32:
+		return append(header(typeUint32, 4), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case []any:
+		out := header(typeArray, len(v))
+		for _, item := range v {
+			out = append(out, encode(item)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := header(typeMap, len(v))
+		for _, key := range keys {
+			out = append(out, encode(key)...)
+			out = append(out, encode(v[key])...)
+		}
+		return out
+	}
+	panic("unsupported test value")
+}
+
+// buildDatabase returns an IPv4 MMDB file with 24-bit records mapping prefix/24 to record.
+func buildDatabase(prefix net.IP, record map[string]any) []byte {
+	const nodeCount = 24
+	ip := prefix.To4()
+
+	var tree []byte
+	for i := 0; i < nodeCount; i++ {
+		bit := ip[i/8] >> (7 - i%8) & 1
+		next := i + 1
+		if i == nodeCount-1 {
+			next = nodeCount + dataSectionSeparator // the first data record
+		}
+		records := [2]int{nodeCount, nodeCount} // not found
+		records[bit] = next
+		for _, r := range records {
+			tree = append(tree, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+
+	buf := append(tree, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, encode(record)...)
+	buf = append(buf, metadataMarker...)
+	return append(buf, encode(map[string]any{
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint16(24),
+		"ip_version":    uint16(4),
+		"database_type": "Test-City",
+	})...)
+}
+
+func cityRecord(city string) map[string]any {
+	return map[string]any{
+		"country":      map[string]any{"iso_code": "GB"},
+		"subdivisions": []any{map[string]any{"names": map[string]any{"en": "England"}}},
+		"city":         map[string]any{"names": map[string]any{"en": city}},
+	}
+}
+
+func TestLocatorLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	os.WriteFile(path, buildDatabase(net.ParseIP("81.2.69.0"), cityRecord("London")), 0644)
+
+	locator, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer locator.Close()
+
+	tests := []struct {
+		ip       string
+		expected Location
+		found    bool
+	}{
+		{"81.2.69.142", Location{Country: "GB", Region: "England", City: "London"}, true},
+		{"81.2.70.1", Location{}, false},
+		{"2001:db8::1", Location{}, false},
+	}
+	for _, tt := range tests {
+		loc, found := locator.Lookup(net.ParseIP(tt.ip))
+		if found != tt.found || loc != tt.expected {
+			t.Errorf("Lookup(%s): expected %+v, %v, got %+v, %v", tt.ip, tt.expected, tt.found, loc, found)
+		}
+	}
+
+	// A changed file is reloaded
+	os.WriteFile(path, buildDatabase(net.ParseIP("81.2.69.0"), cityRecord("Londinium")), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if err := locator.reload(); err != nil {
+		t.Fatalf("Failed to reload database: %v", err)
+	}
+	if loc, _ := locator.Lookup(net.ParseIP("81.2.69.142")); loc.City != "Londinium" {
+		t.Errorf("Expected reloaded city Londinium, got %q", loc.City)
+	}
+
+	// An invalid file keeps the previous database
+	os.WriteFile(path, []byte("not a database"), 0644)
+	os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute))
+	if err := locator.reload(); err == nil {
+		t.Errorf("Expected error reloading an invalid database")
+	}
+	if _, found := locator.Lookup(net.ParseIP("81.2.69.142")); !found {
+		t.Errorf("Expected previous database to stay in use")
+	}
+}
+
+func TestLocatorMissingFile(t *testing.T) {
+	locator, err := Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	if err != nil {
+		t.Fatalf("Expected missing database not to be an error, got %v", err)
+	}
+	defer locator.Close()
+
+	if _, found := locator.Lookup(net.ParseIP("81.2.69.142")); found {
+		t.Errorf("Expected no location without a database")
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"analytics/apps"
+	"analytics/config"
 	fba "analytics/firebase_auth"
+	"analytics/store"
 	"analytics/tracker"
 	"context"
 	"log"
@@ -41,7 +43,7 @@ func corsMiddlewareWrapper(appMgr *apps.Manager) func(http.Handler) http.Handler
 				return
 			}
 
-			app, err := appMgr.GetAppByAPIKey(apiKey)
+			app, err := appMgr.GetAppByAPIKey(apiKey, "")
 			if err != nil {
 				log.Printf("CORS: invalid API key from %s (origin=%s)", r.RemoteAddr, origin)
 				w.WriteHeader(http.StatusUnauthorized)
@@ -66,17 +68,50 @@ func corsMiddlewareWrapper(appMgr *apps.Manager) func(http.Handler) http.Handler
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", apps.NextCursorHeader)
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// openEventStore opens the event store backend selected in the config.
+func openEventStore(cfg config.StoreConfig) (store.EventStore, error) {
+	switch cfg.Backend {
+	case config.StoreBackendSQLite:
+		log.Printf("Using sqlite event store at %s", cfg.SQLitePath)
+		return store.NewSQLiteStore(cfg.SQLitePath)
+	default:
+		log.Printf("Using filesystem event store at %s", cfg.DataDir)
+		return store.NewFileStore(cfg.DataDir), nil
+	}
+}
+
 func main() {
 	log.Print("loading config")
 
+	cfg, err := config.Load("./config.json")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	events, err := openEventStore(cfg.Store)
+	if err != nil {
+		log.Fatalf("Failed to open event store: %v", err)
+	}
+
+	// Commands that only read the event store run instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		err := runExport(events, os.Args[2:])
+		events.Close()
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		return
+	}
+
 	// Initialize config
-	apps, err := apps.NewManager("./app-metadata.json")
+	apps, err := apps.NewManager("./app-metadata.json", events, cfg.Apps)
 	if err != nil {
 		log.Fatalf("Failed to initialize config: %v", err)
 	}
@@ -96,13 +131,19 @@ func main() {
 	// if err != nil {
 	// 	log.Fatalf("Error initializing Firestore: %v", err)
 	// }
-	tracker := tracker.NewEventTracker(apps)
+	tracker, err := tracker.NewEventTracker(apps, events, cfg.Ingest)
+	if err != nil {
+		log.Fatalf("Failed to initialize event tracker: %v", err)
+	}
 	// Set up the router
 	mux := http.NewServeMux()
 
 	mux.Handle("/analytics/api/v1/apps", corsMiddleware(fba.FirebaseAuthMiddleware(apps.ListAppsHandler())))
-	mux.Handle("/analytics/api/v1/apps/", corsMiddleware(fba.FirebaseAuthMiddleware(apps.CrudHandler())))
+	mux.Handle("/analytics/api/v1/apps/", corsMiddleware(apps.AuthMiddleware(apps.CrudHandler())))
+	mux.Handle("/analytics/api/v1/orgs", corsMiddleware(fba.FirebaseAuthMiddleware(apps.OrgsHandler())))
+	mux.Handle("/analytics/api/v1/orgs/", corsMiddleware(fba.FirebaseAuthMiddleware(apps.OrgCrudHandler())))
 	mux.Handle("/analytics/api/v1/track", corsMiddleware(tracker.PostHandler()))
+	mux.Handle("/analytics/api/v1/track/batch", corsMiddleware(tracker.BatchPostHandler()))
 
 	const port = "8115"
 	// Create an HTTP server
@@ -111,19 +152,28 @@ func main() {
 		Handler: mux,
 	}
 
+	// Live event streams never end on their own; close them when shutdown starts.
+	server.RegisterOnShutdown(apps.CloseStreams)
+
 	_, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
 
-	go gracefulShutdown(server, cancel, &wg)
+	stopped := make(chan struct{})
+	go func() {
+		gracefulShutdown(server, cancel, &wg, tracker, apps, events)
+		close(stopped)
+	}()
 
 	log.Println("Starting server on :" + port)
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed: %v", err)
 	}
+	<-stopped
 }
 
-// gracefulShutdown handles shutdown signals and waits for active goroutines to finish
-func gracefulShutdown(server *http.Server, cancel context.CancelFunc, wg *sync.WaitGroup) {
+// gracefulShutdown handles shutdown signals and waits for active goroutines to finish.
+// The tracker, app manager and event store are closed once the server has stopped accepting events.
+func gracefulShutdown(server *http.Server, cancel context.CancelFunc, wg *sync.WaitGroup, eventTracker *tracker.EventTracker, appMgr *apps.Manager, events store.EventStore) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM) // Catch termination signals
 	<-c
@@ -139,5 +189,14 @@ func gracefulShutdown(server *http.Server, cancel context.CancelFunc, wg *sync.W
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Error shutting down server: %v", err)
 	}
+	if err := eventTracker.Close(); err != nil {
+		log.Printf("Error closing event tracker: %v", err)
+	}
+	if err := appMgr.Close(); err != nil {
+		log.Printf("Error closing app manager: %v", err)
+	}
+	if err := events.Close(); err != nil {
+		log.Printf("Error closing event store: %v", err)
+	}
 	log.Println("Server gracefully stopped.")
 }
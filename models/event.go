@@ -17,17 +17,30 @@ type Event struct {
 	Location   *LocationInfo          `json:"location,omitempty"`
 	Web        *WebInfo               `json:"web_specific,omitempty"`
 	Properties map[string]interface{} `json:"properties,omitempty"`
+	IsBot      bool                   `json:"is_bot,omitempty"` // set by the tracker's bot classifier
+
+	// SchemaViolations lists how the event does not match its app's schema, for apps that accept such events with a warning.
+	SchemaViolations []string `json:"schema_violations,omitempty"`
 }
 
 type UserInfo struct {
 	ID          string `json:"id,omitempty"`
 	SessionID   string `json:"session_id"`
 	AnonymousID string `json:"anonymous_id,omitempty"`
+
+	// AnonymousIDDerived is set when the server derived the anonymous ID from the
+	// client IP and user agent, so it is shared by everyone behind one NAT with
+	// the same browser.
+	AnonymousIDDerived bool `json:"anonymous_id_derived,omitempty"`
 }
 
 type DeviceInfo struct {
 	Platform         string `json:"platform"`
+	OSName           string `json:"os_name,omitempty"`
 	OSVersion        string `json:"os_version,omitempty"`
+	Browser          string `json:"browser,omitempty"`
+	BrowserVersion   string `json:"browser_version,omitempty"`
+	DeviceClass      string `json:"device_class,omitempty"` // one of the DeviceClass constants
 	DeviceModel      string `json:"device_model,omitempty"`
 	ScreenResolution string `json:"screen_resolution,omitempty"`
 	Locale           string `json:"locale,omitempty"`
@@ -51,6 +64,14 @@ type WebInfo struct {
 	PageTitle   string `json:"page_title,omitempty"`
 }
 
+// DeviceClass constants
+const (
+	DeviceClassDesktop = "desktop"
+	DeviceClassMobile  = "mobile"
+	DeviceClassTablet  = "tablet"
+	DeviceClassBot     = "bot"
+)
+
 // EventType constants
 const (
 	EventTypePageView = "page_view"
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// jsonFields caches, per struct type, the field index of each JSON name.
+var jsonFields sync.Map // reflect.Type -> map[string]int
+
+// Field resolves a dotted path of JSON names against the event, e.g. "event_type",
+// "device.locale", "web_specific.page_url" or "properties.plan". Paths into Properties
+// may continue into nested objects. It reports false when the path does not exist,
+// and for unset struct fields: nil pointers and maps, empty strings and zero times.
+// Bool and numeric fields are always present, so is_bot=false matches human events.
+func (e *Event) Field(path string) (interface{}, bool) {
+	v := reflect.ValueOf(e).Elem()
+	fromMap := false
+
+	for _, part := range strings.Split(path, ".") {
+		v = indirect(v)
+		if !v.IsValid() {
+			return nil, false
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			index, ok := jsonFieldIndex(v.Type(), part)
+			if !ok {
+				return nil, false
+			}
+			v = v.Field(index)
+			fromMap = false
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			v = v.MapIndex(reflect.ValueOf(part))
+			fromMap = true
+		default:
+			return nil, false
+		}
+	}
+
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil, false
+	}
+	// A property explicitly set to 0 or "" is a value; an unset struct field is not.
+	if !fromMap && isUnset(v) {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+// isUnset reports whether a struct field holds no value, as opposed to a zero value.
+func isUnset(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Map, reflect.Slice:
+		return v.IsNil()
+	case reflect.Struct:
+		return v.IsZero()
+	}
+	return false
+}
+
+// indirect follows pointers and interfaces, returning an invalid Value for nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func jsonFieldIndex(t reflect.Type, name string) (int, bool) {
+	if cached, ok := jsonFields.Load(t); ok {
+		index, found := cached.(map[string]int)[name]
+		return index, found
+	}
+
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tagName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch tagName {
+		case "-":
+			continue
+		case "":
+			tagName = field.Name
+		}
+		fields[tagName] = i
+	}
+	jsonFields.Store(t, fields)
+
+	index, found := fields[name]
+	return index, found
+}
@@ -0,0 +1,269 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"analytics/models"
+)
+
+// FileStore is the filesystem EventStore. Events live in hourly NDJSON segments
+// under <root>/<app-id>/<utc-date-YYYYMMDD>/, next to legacy one-file-per-event JSON files.
+type FileStore struct {
+	root   string
+	writer *SegmentWriter
+}
+
+// NewFileStore creates a FileStore rooted at root.
+func NewFileStore(root string) *FileStore {
+	return &FileStore{
+		root:   root,
+		writer: NewSegmentWriter(root),
+	}
+}
+
+func (s *FileStore) Append(appID string, event *models.Event) error {
+	return s.writer.Append(appID, event)
+}
+
+func (s *FileStore) Scan(appID string, start, end time.Time, fn func(event models.Event) error) error {
+	// Make buffered appends visible to the readers below; fsync is left to the sync routine.
+	if err := s.writer.flush(appID); err != nil {
+		return err
+	}
+	return s.scan(appID, start, end, fn)
+}
+
+// scan reads the app's files without touching the writer.
+func (s *FileStore) scan(appID string, start, end time.Time, fn func(event models.Event) error) error {
+	days, err := s.days(appID)
+	if err != nil {
+		return err
+	}
+
+	// Day directories are by receipt time, so look one slack beyond the range.
+	first := start.Add(-SegmentSlack).UTC().Truncate(24 * time.Hour)
+	last := end.Add(SegmentSlack).UTC()
+
+	for _, day := range days {
+		if day.Before(first) || !day.Before(last) {
+			continue
+		}
+		dir := filepath.Join(s.root, appID, day.Format("20060102"))
+		err := scanDay(dir, day, start, end, func(event models.Event) error {
+			if event.Timestamp.Before(start) || !event.Timestamp.Before(end) {
+				return nil
+			}
+			return fn(event)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(appID string, match func(event *models.Event) bool) (int, error) {
+	if match == nil {
+		deleted := 0
+		err := s.writer.withAppSealed(appID, func() error {
+			var err error
+			deleted, err = s.countAll(appID)
+			if err != nil {
+				return err
+			}
+			return os.RemoveAll(filepath.Join(s.root, appID))
+		})
+		return deleted, err
+	}
+
+	days, err := s.days(appID)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, day := range days {
+		dir := filepath.Join(s.root, appID, day.Format("20060102"))
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to read directory %s: %v", dir, err)
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			var n int
+			switch {
+			case strings.HasSuffix(entry.Name(), SegmentSuffix):
+				// Any segment may still be open in the writer with lines buffered,
+				// including one of a past hour, so keep the writer out while it is rewritten
+				err = s.writer.withAppSealed(appID, func() error {
+					var rewriteErr error
+					n, rewriteErr = rewriteSegment(path, match)
+					return rewriteErr
+				})
+			case strings.HasSuffix(entry.Name(), ".json"):
+				n, err = deleteEventFile(path, match)
+			}
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+		}
+	}
+	return deleted, nil
+}
+
+func (s *FileStore) Close() error {
+	return s.writer.Close()
+}
+
+// days lists the day directories of an app in ascending order.
+func (s *FileStore) days(appID string) ([]time.Time, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, appID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app directory %s: %v", appID, err)
+	}
+
+	days := make([]time.Time, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		day, err := time.Parse("20060102", entry.Name())
+		if err != nil {
+			continue
+		}
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+// countAll counts the app's events. The app's segment must already be sealed.
+func (s *FileStore) countAll(appID string) (int, error) {
+	count := 0
+	err := s.scan(appID, time.Time{}, time.Now().UTC().Add(24*time.Hour), func(models.Event) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// rewriteSegment rewrites a segment without the events matched by match.
+// The segment is replaced atomically and left untouched if nothing matched.
+func rewriteSegment(path string, match func(event *models.Event) bool) (int, error) {
+	in, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("open segment %s: %w", path, err)
+	}
+	defer in.Close()
+
+	tmpPath := path + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("create %s: %w", tmpPath, err)
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	reader := bufio.NewReader(in)
+	deleted := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var event models.Event
+			if json.Unmarshal(line, &event) == nil && match(&event) {
+				deleted++
+			} else if _, werr := w.Write(line); werr != nil {
+				return 0, fmt.Errorf("write %s: %w", tmpPath, werr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read segment %s: %w", path, err)
+		}
+	}
+
+	if deleted == 0 {
+		return 0, nil
+	}
+	if err := w.Flush(); err != nil {
+		return 0, fmt.Errorf("write %s: %w", tmpPath, err)
+	}
+	if err := out.Sync(); err != nil {
+		return 0, fmt.Errorf("sync %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, fmt.Errorf("replace segment %s: %w", path, err)
+	}
+	return deleted, nil
+}
+
+// deleteEventFile removes a legacy event file if match selects its event.
+func deleteEventFile(path string, match func(event *models.Event) bool) (int, error) {
+	event, err := readEventFile(path)
+	if err != nil || !match(&event) {
+		return 0, nil
+	}
+	if err := os.Remove(path); err != nil {
+		return 0, fmt.Errorf("remove %s: %w", path, err)
+	}
+	return 1, nil
+}
+
+// flush writes the app's buffered appends to its segment file without fsyncing it.
+func (w *SegmentWriter) flush(appID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if seg, ok := w.segments[appID]; ok {
+		if err := seg.w.Flush(); err != nil {
+			return fmt.Errorf("flush segment %s: %w", seg.file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// withAppSealed closes the app's open segment and runs fn while the app's appends
+// are blocked, so fn can rewrite or remove the app's segments. Appends of other
+// apps go on while fn runs. The next append reopens a segment.
+func (w *SegmentWriter) withAppSealed(appID string, fn func() error) error {
+	appLock := w.appLock(appID)
+	appLock.Lock()
+	defer appLock.Unlock()
+
+	if err := w.seal(appID); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// seal closes the app's open segment, if any.
+func (w *SegmentWriter) seal(appID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if seg, ok := w.segments[appID]; ok {
+		delete(w.segments, appID)
+		if err := seg.close(); err != nil {
+			return fmt.Errorf("close segment %s: %w", seg.file.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,407 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"analytics/models"
+)
+
+const (
+	// DefaultDataDir is the root directory for event data, relative to the working directory.
+	DefaultDataDir = "data"
+
+	// SegmentSuffix is the file extension of NDJSON segment files.
+	SegmentSuffix = ".ndjson"
+
+	// DefaultSyncInterval is how often buffered segment writes are flushed and fsynced.
+	DefaultSyncInterval = time.Second
+
+	// DefaultMaxSegmentBytes is the size at which a segment is rotated within the same hour.
+	DefaultMaxSegmentBytes = 64 << 20
+
+	// SegmentSlack widens the hour range of a segment when deciding whether it can hold
+	// events for a query. Segments are filed by receipt time, while event timestamps may
+	// differ from it by the tracker's allowed clock drift.
+	SegmentSlack = 10 * time.Minute
+)
+
+// SegmentWriter appends events to hourly NDJSON segments:
+//
+//	<root>/<app-id>/<utc-date-YYYYMMDD>/<HH>-<seq>.ndjson
+//
+// Writes are buffered and fsynced in batches every syncInterval, so an accepted
+// event may be lost if the process crashes within that interval.
+// A segment is rotated when the hour changes or it grows past maxSegmentBytes.
+type SegmentWriter struct {
+	root            string
+	syncInterval    time.Duration
+	maxSegmentBytes int64
+	segments        map[string]*segment    // appID -> open segment
+	appLocks        map[string]*sync.Mutex // appID -> lock serializing the app's appends and rewrites
+	mu              sync.Mutex             // Protects segments and appLocks
+	done            chan struct{}
+	stopped         chan struct{}
+	stopOnce        sync.Once
+}
+
+type segment struct {
+	hour  time.Time
+	seq   int
+	file  *os.File
+	w     *bufio.Writer
+	size  int64
+	dirty bool
+}
+
+// NewSegmentWriter creates a SegmentWriter rooted at root with default sync and rotation settings.
+func NewSegmentWriter(root string) *SegmentWriter {
+	return NewSegmentWriterWithOptions(root, DefaultSyncInterval, DefaultMaxSegmentBytes)
+}
+
+// NewSegmentWriterWithOptions creates a SegmentWriter and starts its sync routine.
+func NewSegmentWriterWithOptions(root string, syncInterval time.Duration, maxSegmentBytes int64) *SegmentWriter {
+	w := &SegmentWriter{
+		root:            root,
+		syncInterval:    syncInterval,
+		maxSegmentBytes: maxSegmentBytes,
+		segments:        make(map[string]*segment),
+		appLocks:        make(map[string]*sync.Mutex),
+		done:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	go w.syncLoop()
+	return w
+}
+
+// Append writes an event as one line to the app's current segment.
+func (w *SegmentWriter) Append(appID string, event *models.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	line = append(line, '\n')
+
+	appLock := w.appLock(appID)
+	appLock.Lock()
+	defer appLock.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seg, err := w.segmentFor(appID, time.Now().UTC().Truncate(time.Hour), int64(len(line)))
+	if err != nil {
+		return err
+	}
+
+	n, err := seg.w.Write(line)
+	seg.size += int64(n)
+	seg.dirty = true
+	if err != nil {
+		return fmt.Errorf("append to segment %s: %w", seg.file.Name(), err)
+	}
+	return nil
+}
+
+// appLock returns the lock held while appending to or rewriting the app's
+// segments. It is taken before w.mu, so a rewrite holding it blocks only the
+// app's own appends.
+func (w *SegmentWriter) appLock(appID string) *sync.Mutex {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	lock, ok := w.appLocks[appID]
+	if !ok {
+		lock = &sync.Mutex{}
+		w.appLocks[appID] = lock
+	}
+	return lock
+}
+
+// segmentFor returns the open segment for appID that can take n more bytes in hour,
+// rotating the current one if needed. Must be called with w.mu held.
+func (w *SegmentWriter) segmentFor(appID string, hour time.Time, n int64) (*segment, error) {
+	seg := w.segments[appID]
+	if seg != nil && seg.hour.Equal(hour) && (seg.size == 0 || seg.size+n <= w.maxSegmentBytes) {
+		return seg, nil
+	}
+
+	seq := 0
+	if seg != nil {
+		if seg.hour.Equal(hour) {
+			seq = seg.seq + 1
+		}
+		if err := seg.close(); err != nil {
+			log.Printf("SegmentWriter: Failed to close segment %s: %v", seg.file.Name(), err)
+		}
+		delete(w.segments, appID)
+	}
+
+	seg, err := w.openSegment(appID, hour, seq, n)
+	if err != nil {
+		return nil, err
+	}
+	w.segments[appID] = seg
+	return seg, nil
+}
+
+// openSegment opens the first segment of the hour, starting at seq, with room for n bytes.
+// Existing segments are appended to, so a restart continues the hour's last segment.
+func (w *SegmentWriter) openSegment(appID string, hour time.Time, seq int, n int64) (*segment, error) {
+	dir := filepath.Join(w.root, appID, hour.Format("20060102"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create directories for %s: %w", dir, err)
+	}
+
+	for ; ; seq++ {
+		path := filepath.Join(dir, segmentName(hour, seq))
+		info, err := os.Stat(path)
+		if err == nil && info.Size() > 0 && info.Size()+n > w.maxSegmentBytes {
+			continue
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open segment %s: %w", path, err)
+		}
+		seg := &segment{hour: hour, seq: seq, file: file, w: bufio.NewWriter(file)}
+		if info != nil {
+			seg.size = info.Size()
+		}
+		if err := seg.terminatePartialLine(); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return seg, nil
+	}
+}
+
+// terminatePartialLine ends a line left unterminated by a crash so the next
+// event is not glued onto it.
+func (s *segment) terminatePartialLine() error {
+	if s.size == 0 {
+		return nil
+	}
+	f, err := os.Open(s.file.Name())
+	if err != nil {
+		return fmt.Errorf("open segment %s: %w", s.file.Name(), err)
+	}
+	defer f.Close()
+
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, s.size-1); err != nil {
+		return fmt.Errorf("read segment %s: %w", s.file.Name(), err)
+	}
+	if last[0] != '\n' {
+		n, _ := s.w.WriteString("\n")
+		s.size += int64(n)
+		s.dirty = true
+	}
+	return nil
+}
+
+func (s *segment) sync() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *segment) close() error {
+	if err := s.sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// syncLoop flushes dirty segments every syncInterval and closes segments of past hours.
+func (w *SegmentWriter) syncLoop() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.syncAll()
+		}
+	}
+}
+
+func (w *SegmentWriter) syncAll() {
+	currentHour := time.Now().UTC().Truncate(time.Hour)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for appID, seg := range w.segments {
+		if seg.hour.Before(currentHour) {
+			if err := seg.close(); err != nil {
+				log.Printf("SegmentWriter: Failed to close segment %s: %v", seg.file.Name(), err)
+			}
+			delete(w.segments, appID)
+			continue
+		}
+		if err := seg.sync(); err != nil {
+			log.Printf("SegmentWriter: Failed to sync segment %s: %v", seg.file.Name(), err)
+		}
+	}
+}
+
+// Close stops the sync routine and flushes and closes all open segments.
+// Safe to call multiple times.
+func (w *SegmentWriter) Close() error {
+	var firstErr error
+	w.stopOnce.Do(func() {
+		close(w.done)
+		<-w.stopped
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for appID, seg := range w.segments {
+			if err := seg.close(); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("close segment %s: %w", seg.file.Name(), err)
+			}
+			delete(w.segments, appID)
+		}
+	})
+	return firstErr
+}
+
+func segmentName(hour time.Time, seq int) string {
+	return fmt.Sprintf("%02d-%03d%s", hour.Hour(), seq, SegmentSuffix)
+}
+
+// segmentHour parses the hour from a segment file name like "13-000.ndjson".
+func segmentHour(name string) (int, bool) {
+	hourStr, _, found := strings.Cut(strings.TrimSuffix(name, SegmentSuffix), "-")
+	if !found {
+		return 0, false
+	}
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, false
+	}
+	return hour, true
+}
+
+// scanDay calls fn for every event stored in dir, the directory of one UTC day.
+// It reads both NDJSON segments and legacy one-file-per-event JSON files, streaming
+// them so the number of events per day is not limited. Segments whose hour cannot hold
+// events in [since, until) are skipped. Unreadable files and lines are logged and skipped.
+func scanDay(dir string, day, since, until time.Time, fn func(event models.Event) error) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read directory %s: %v", dir, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		switch {
+		case strings.HasSuffix(name, SegmentSuffix):
+			if hour, ok := segmentHour(name); ok && !segmentOverlaps(day, hour, since, until) {
+				continue
+			}
+			if err := scanSegment(path, fn); err != nil {
+				return err
+			}
+		case strings.HasSuffix(name, ".json"):
+			event, err := readEventFile(path)
+			if err != nil {
+				log.Printf("scanDay: Failed to read event %s: %v", path, err)
+				continue
+			}
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// segmentOverlaps reports whether a segment for hour of day may hold events in [since, until).
+func segmentOverlaps(day time.Time, hour int, since, until time.Time) bool {
+	segmentStart := day.Add(time.Duration(hour) * time.Hour).Add(-SegmentSlack)
+	segmentEnd := day.Add(time.Duration(hour+1) * time.Hour).Add(SegmentSlack)
+	return segmentEnd.After(since) && segmentStart.Before(until)
+}
+
+// scanSegment calls fn for every event line in an NDJSON segment.
+func scanSegment(path string, fn func(event models.Event) error) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open segment %s: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			if trimmed := strings.TrimSpace(string(line)); trimmed != "" {
+				var event models.Event
+				if jsonErr := json.Unmarshal([]byte(trimmed), &event); jsonErr != nil {
+					log.Printf("scanSegment: Failed to parse line %d of %s: %v", lineNo, path, jsonErr)
+				} else if fnErr := fn(event); fnErr != nil {
+					return fnErr
+				}
+			}
+		}
+		// An unterminated last line is a write in progress or a torn write; skip it.
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read segment %s: %w", path, err)
+		}
+	}
+}
+
+func readEventFile(filePath string) (models.Event, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	var event models.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return models.Event{}, err
+	}
+
+	return event, nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"analytics/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func scanAll(t *testing.T, root, appID string, date, since time.Time) []models.Event {
+	t.Helper()
+	events := make([]models.Event, 0)
+	dir := filepath.Join(root, appID, date.Format("20060102"))
+	day := date.UTC().Truncate(24 * time.Hour)
+	err := scanDay(dir, day, since, day.Add(48*time.Hour), func(event models.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scanDay failed: %v", err)
+	}
+	return events
+}
+
+func TestSegmentWriterAppendAndScan(t *testing.T) {
+	root := t.TempDir()
+	writer := NewSegmentWriter(root)
+
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		event := &models.Event{EventID: fmt.Sprintf("event%d", i), Timestamp: now}
+		if err := writer.Append("test-app", event); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	events := scanAll(t, root, "test-app", now, now.Add(-time.Hour))
+	if len(events) != 5 {
+		t.Fatalf("Expected 5 events, got %d", len(events))
+	}
+	for i, event := range events {
+		if expected := fmt.Sprintf("event%d", i); event.EventID != expected {
+			t.Errorf("Expected %s at position %d, got %s", expected, i, event.EventID)
+		}
+	}
+
+	files, _ := os.ReadDir(filepath.Join(root, "test-app", now.Format("20060102")))
+	if len(files) != 1 {
+		t.Errorf("Expected 1 segment file, got %d", len(files))
+	}
+}
+
+func TestSegmentWriterRotatesBySize(t *testing.T) {
+	root := t.TempDir()
+	writer := NewSegmentWriterWithOptions(root, time.Hour, 200)
+
+	now := time.Now().UTC()
+	for i := 0; i < 6; i++ {
+		event := &models.Event{EventID: fmt.Sprintf("event%d", i), Timestamp: now}
+		if err := writer.Append("test-app", event); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	writer.Close()
+
+	files, _ := os.ReadDir(filepath.Join(root, "test-app", now.Format("20060102")))
+	if len(files) < 2 {
+		t.Errorf("Expected segment to rotate, got %d files", len(files))
+	}
+
+	events := scanAll(t, root, "test-app", now, now.Add(-time.Hour))
+	if len(events) != 6 {
+		t.Errorf("Expected 6 events across segments, got %d", len(events))
+	}
+}
+
+func TestSegmentWriterRepairsTornLine(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour)
+	dir := filepath.Join(root, "test-app", now.Format("20060102"))
+	os.MkdirAll(dir, 0755)
+
+	// Simulate a crash in the middle of writing a line
+	torn := `{"event_id":"complete"}` + "\n" + `{"event_id":"tor`
+	os.WriteFile(filepath.Join(dir, segmentName(hour, 0)), []byte(torn), 0644)
+
+	writer := NewSegmentWriter(root)
+	if err := writer.Append("test-app", &models.Event{EventID: "after-crash", Timestamp: now}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	writer.Close()
+
+	events := scanAll(t, root, "test-app", now, now.Add(-time.Hour))
+	ids := make(map[string]bool)
+	for _, event := range events {
+		ids[event.EventID] = true
+	}
+	if len(events) != 2 || !ids["complete"] || !ids["after-crash"] {
+		t.Errorf("Expected complete and after-crash events, got %v", ids)
+	}
+}
+
+func TestScanDayReadsLegacyFilesAndSkipsOldSegments(t *testing.T) {
+	root := t.TempDir()
+	date := time.Date(2025, 8, 24, 0, 0, 0, 0, time.UTC)
+	dir := filepath.Join(root, "test-app", date.Format("20060102"))
+	os.MkdirAll(dir, 0755)
+
+	legacy, _ := json.Marshal(models.Event{EventID: "legacy", Timestamp: date.Add(12 * time.Hour)})
+	os.WriteFile(filepath.Join(dir, "legacy.json"), legacy, 0644)
+
+	early, _ := json.Marshal(models.Event{EventID: "early", Timestamp: date.Add(2 * time.Hour)})
+	os.WriteFile(filepath.Join(dir, segmentName(date.Add(2*time.Hour), 0)), append(early, '\n'), 0644)
+
+	late, _ := json.Marshal(models.Event{EventID: "late", Timestamp: date.Add(14 * time.Hour)})
+	os.WriteFile(filepath.Join(dir, segmentName(date.Add(14*time.Hour), 0)), append(late, '\n'), 0644)
+
+	events := scanAll(t, root, "test-app", date, date.Add(10*time.Hour))
+	ids := make(map[string]bool)
+	for _, event := range events {
+		ids[event.EventID] = true
+	}
+	if ids["early"] {
+		t.Errorf("Expected segment for hour 02 to be skipped")
+	}
+	if !ids["legacy"] || !ids["late"] {
+		t.Errorf("Expected legacy and late events, got %v", ids)
+	}
+
+	if events := scanAll(t, root, "missing-app", date, date); len(events) != 0 {
+		t.Errorf("Expected no events for missing app, got %d", len(events))
+	}
+}
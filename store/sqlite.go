@@ -0,0 +1,166 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"analytics/models"
+
+	_ "modernc.org/sqlite" // pure-Go driver, registers "sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	app_id   TEXT    NOT NULL,
+	event_id TEXT    NOT NULL,
+	ts       INTEGER NOT NULL, -- event timestamp, unix nanoseconds UTC
+	body     TEXT    NOT NULL  -- event JSON
+);
+CREATE INDEX IF NOT EXISTS events_app_ts ON events (app_id, ts);
+`
+
+// deleteBatchSize is the number of rows removed per transaction in Delete.
+const deleteBatchSize = 500
+
+// SQLiteStore is an EventStore backed by an embedded SQLite database.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the SQLite database at path.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create directories for %s: %w", path, err)
+	}
+
+	dsn := "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema in %s: %w", path, err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Append(appID string, event *models.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT INTO events (app_id, event_id, ts, body) VALUES (?, ?, ?, ?)`,
+		appID, event.EventID, event.Timestamp.UTC().UnixNano(), string(body))
+	if err != nil {
+		return fmt.Errorf("insert event: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Scan(appID string, start, end time.Time, fn func(event models.Event) error) error {
+	rows, err := s.db.Query(`SELECT body FROM events WHERE app_id = ? AND ts >= ? AND ts < ? ORDER BY ts`,
+		appID, unixNano(start), unixNano(end))
+	if err != nil {
+		return fmt.Errorf("query events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return fmt.Errorf("read event row: %w", err)
+		}
+		var event models.Event
+		if err := json.Unmarshal([]byte(body), &event); err != nil {
+			log.Printf("SQLiteStore.Scan: Failed to parse event for app %s: %v", appID, err)
+			continue
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query events: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Delete(appID string, match func(event *models.Event) bool) (int, error) {
+	if match == nil {
+		res, err := s.db.Exec(`DELETE FROM events WHERE app_id = ?`, appID)
+		if err != nil {
+			return 0, fmt.Errorf("delete events: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		return int(n), nil
+	}
+
+	rows, err := s.db.Query(`SELECT rowid, body FROM events WHERE app_id = ?`, appID)
+	if err != nil {
+		return 0, fmt.Errorf("query events: %w", err)
+	}
+	rowIDs := make([]int64, 0)
+	for rows.Next() {
+		var rowID int64
+		var body string
+		if err := rows.Scan(&rowID, &body); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("read event row: %w", err)
+		}
+		var event models.Event
+		if json.Unmarshal([]byte(body), &event) == nil && match(&event) {
+			rowIDs = append(rowIDs, rowID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("query events: %w", err)
+	}
+
+	deleted := 0
+	for len(rowIDs) > 0 {
+		batch := rowIDs
+		if len(batch) > deleteBatchSize {
+			batch = batch[:deleteBatchSize]
+		}
+		rowIDs = rowIDs[len(batch):]
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return deleted, fmt.Errorf("begin delete: %w", err)
+		}
+		for _, rowID := range batch {
+			if _, err := tx.Exec(`DELETE FROM events WHERE rowid = ?`, rowID); err != nil {
+				tx.Rollback()
+				return deleted, fmt.Errorf("delete event: %w", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return deleted, fmt.Errorf("commit delete: %w", err)
+		}
+		deleted += len(batch)
+	}
+	return deleted, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// unixNano converts t to nanoseconds, clamping times outside the int64 range.
+func unixNano(t time.Time) int64 {
+	const minTime, maxTime = -1 << 63, 1<<63 - 1
+	switch {
+	case t.Before(time.Unix(0, minTime)):
+		return minTime
+	case t.After(time.Unix(0, maxTime)):
+		return maxTime
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"time"
+
+	"analytics/models"
+)
+
+// EventStore persists events per app. It is shared by the tracker, which appends
+// events, and apps.Manager, which reads them back for queries.
+type EventStore interface {
+	// Append stores an event under appID.
+	Append(appID string, event *models.Event) error
+
+	// Scan calls fn for every event of appID with start <= timestamp < end.
+	// Events are not guaranteed to be in timestamp order. Scan stops at the first error returned by fn.
+	Scan(appID string, start, end time.Time, fn func(event models.Event) error) error
+
+	// Delete removes the events of appID for which match returns true and reports
+	// how many were removed. A nil match removes all events of the app.
+	Delete(appID string, match func(event *models.Event) bool) (int, error)
+
+	// Close flushes pending writes and releases resources.
+	Close() error
+}
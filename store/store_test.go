@@ -0,0 +1,189 @@
+package store
+
+import (
+	"analytics/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStores(t *testing.T) map[string]EventStore {
+	t.Helper()
+	sqliteStore, err := NewSQLiteStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	stores := map[string]EventStore{
+		"fs":     NewFileStore(t.TempDir()),
+		"sqlite": sqliteStore,
+	}
+	t.Cleanup(func() {
+		for _, s := range stores {
+			s.Close()
+		}
+	})
+	return stores
+}
+
+func TestEventStoreScanAndDelete(t *testing.T) {
+	now := time.Now().UTC()
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 6; i++ {
+				event := &models.Event{
+					EventID:   fmt.Sprintf("event%d", i),
+					Timestamp: now.Add(-time.Duration(i) * time.Minute),
+					User:      models.UserInfo{ID: fmt.Sprintf("user%d", i%2)},
+				}
+				if err := s.Append("test-app", event); err != nil {
+					t.Fatalf("Append failed: %v", err)
+				}
+			}
+			if err := s.Append("other-app", &models.Event{EventID: "other", Timestamp: now}); err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+
+			scan := func(start, end time.Time) map[string]bool {
+				ids := make(map[string]bool)
+				err := s.Scan("test-app", start, end, func(event models.Event) error {
+					ids[event.EventID] = true
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("Scan failed: %v", err)
+				}
+				return ids
+			}
+
+			all := scan(now.Add(-time.Hour), now.Add(time.Hour))
+			if len(all) != 6 || all["other"] {
+				t.Fatalf("Expected the 6 test-app events, got %v", all)
+			}
+
+			// Range is [start, end)
+			ranged := scan(now.Add(-3*time.Minute), now.Add(-time.Minute))
+			if len(ranged) != 2 || !ranged["event2"] || !ranged["event3"] {
+				t.Errorf("Expected event2 and event3, got %v", ranged)
+			}
+
+			deleted, err := s.Delete("test-app", func(event *models.Event) bool {
+				return event.User.ID == "user1"
+			})
+			if err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if deleted != 3 {
+				t.Errorf("Expected 3 events deleted, got %d", deleted)
+			}
+
+			remaining := scan(now.Add(-time.Hour), now.Add(time.Hour))
+			if len(remaining) != 3 || remaining["event1"] {
+				t.Errorf("Expected event0, event2 and event4 to remain, got %v", remaining)
+			}
+
+			// Appending after a delete keeps working
+			if err := s.Append("test-app", &models.Event{EventID: "late", Timestamp: now}); err != nil {
+				t.Fatalf("Append after delete failed: %v", err)
+			}
+			if ids := scan(now.Add(-time.Hour), now.Add(time.Hour)); !ids["late"] {
+				t.Errorf("Expected event appended after delete, got %v", ids)
+			}
+
+			if _, err := s.Delete("test-app", nil); err != nil {
+				t.Fatalf("Delete all failed: %v", err)
+			}
+			if ids := scan(now.Add(-time.Hour), now.Add(time.Hour)); len(ids) != 0 {
+				t.Errorf("Expected no events after deleting app, got %v", ids)
+			}
+		})
+	}
+}
+
+func TestFileStoreDeleteSealsPastHourSegment(t *testing.T) {
+	root := t.TempDir()
+	// No periodic sync, so the segment stays open with its lines buffered
+	s := &FileStore{root: root, writer: NewSegmentWriterWithOptions(root, time.Hour, DefaultMaxSegmentBytes)}
+	defer s.Close()
+
+	now := time.Now().UTC()
+	for i, user := range []string{"keep", "erase", "keep"} {
+		s.Append("test-app", &models.Event{EventID: fmt.Sprintf("event%d", i), Timestamp: now, User: models.UserInfo{ID: user}})
+	}
+
+	// Turn the open segment into one of the previous hour, as right after the hour changes
+	s.writer.mu.Lock()
+	seg := s.writer.segments["test-app"]
+	seg.hour = seg.hour.Add(-time.Hour)
+	past := filepath.Join(root, "test-app", seg.hour.Format("20060102"), segmentName(seg.hour, 0))
+	os.MkdirAll(filepath.Dir(past), 0755)
+	if err := os.Rename(seg.file.Name(), past); err != nil {
+		t.Fatalf("Failed to move segment: %v", err)
+	}
+	s.writer.mu.Unlock()
+
+	deleted, err := s.Delete("test-app", func(event *models.Event) bool { return event.User.ID == "erase" })
+	if err != nil || deleted != 1 {
+		t.Fatalf("Expected 1 event deleted, got %d, %v", deleted, err)
+	}
+
+	var remaining []string
+	s.Scan("test-app", now.Add(-3*time.Hour), now.Add(time.Hour), func(event models.Event) error {
+		remaining = append(remaining, event.EventID)
+		return nil
+	})
+	if len(remaining) != 2 || remaining[0] != "event0" || remaining[1] != "event2" {
+		t.Errorf("Expected event0 and event2 kept, got %v", remaining)
+	}
+}
+
+func TestFileStoreDeleteBlocksOnlyItsApp(t *testing.T) {
+	root := t.TempDir()
+	s := NewFileStore(root)
+	defer s.Close()
+
+	now := time.Now().UTC()
+	s.Append("erased-app", &models.Event{EventID: "old", Timestamp: now})
+
+	release := make(chan struct{})
+	sealed := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.writer.withAppSealed("erased-app", func() error {
+			close(sealed)
+			<-release
+			return nil
+		})
+	}()
+	<-sealed
+
+	// Another app appends while the rewrite runs
+	appended := make(chan error, 1)
+	go func() { appended <- s.Append("other-app", &models.Event{EventID: "other", Timestamp: now}) }()
+	select {
+	case err := <-appended:
+		if err != nil {
+			t.Errorf("Append failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("Expected appends of other apps not to wait for the rewrite")
+	}
+
+	// The app's own appends wait for it
+	go func() { appended <- s.Append("erased-app", &models.Event{EventID: "new", Timestamp: now}) }()
+	select {
+	case <-appended:
+		t.Error("Expected the app's appends to wait for the rewrite")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("withAppSealed failed: %v", err)
+	}
+	if err := <-appended; err != nil {
+		t.Errorf("Append failed: %v", err)
+	}
+}
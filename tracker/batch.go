@@ -0,0 +1,191 @@
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"analytics/apps"
+	"analytics/models"
+)
+
+const (
+	// MaxBatchEvents is the maximum number of events accepted in one batch request.
+	MaxBatchEvents = 500
+	// MaxBatchBytes is the maximum size of a batch request body.
+	MaxBatchBytes = 5 << 20
+)
+
+// Batch result statuses
+const (
+	BatchStatusAccepted = "accepted"
+	BatchStatusRejected = "rejected"
+)
+
+// BatchResult reports the outcome for one event of a batch, in request order.
+// Retryable is set when the failure was on our side and the SDK should resend the event.
+// Duplicate is set when the event ID was already accepted, so the event was not stored again.
+type BatchResult struct {
+	Index     int    `json:"index"`
+	EventID   string `json:"event_id,omitempty"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+}
+
+// BatchPostHandler accepts many events under one API key, either as a JSON array
+// or as NDJSON (one event per line, Content-Type application/x-ndjson).
+// Each event is processed independently and the response lists a result per event.
+func (h *EventTracker) BatchPostHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientIP := h.clientIP(r)
+		log.Printf("BatchPostHandler: %s %s", r.Method, r.URL.Path)
+
+		app, ok := h.authorizePost(w, r, "BatchPostHandler", clientIP)
+		if !ok {
+			return
+		}
+		logIP := h.logIP(clientIP, app)
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBatchBytes))
+		if err != nil {
+			log.Printf("BatchPostHandler: failed to read body from %s (app=%s): %v", logIP, app.ID, err)
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		raws, err := splitBatch(body, isNDJSON(r))
+		if err != nil {
+			log.Printf("BatchPostHandler: failed to decode batch from %s (app=%s): %v", logIP, app.ID, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(raws) > MaxBatchEvents {
+			log.Printf("BatchPostHandler: batch of %d events from %s exceeds limit (app=%s)", len(raws), logIP, app.ID)
+			http.Error(w, fmt.Sprintf("batch exceeds %d events", MaxBatchEvents), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !h.limitRate(w, r, "BatchPostHandler", app, clientIP, len(raws)) {
+			return
+		}
+
+		results := make([]BatchResult, 0, len(raws))
+		accepted := 0
+		var retryAfter time.Duration
+		for i, raw := range raws {
+			result, wait := h.trackRawEvent(i, raw, app, r)
+			if result.Status == BatchStatusAccepted {
+				accepted++
+			}
+			retryAfter = max(retryAfter, wait)
+			results = append(results, result)
+		}
+		log.Printf("BatchPostHandler: accepted %d/%d events (app=%s)", accepted, len(results), app.ID)
+
+		if retryAfter > 0 {
+			setRetryAfter(w, retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":   "success",
+			"accepted": accepted,
+			"rejected": len(results) - accepted,
+			"results":  results,
+		})
+	}
+}
+
+// trackRawEvent decodes and tracks one event of a batch. If the app's quota
+// is exhausted it also returns how long until it resets.
+func (h *EventTracker) trackRawEvent(index int, raw json.RawMessage, app *apps.App, r *http.Request) (BatchResult, time.Duration) {
+	result := BatchResult{Index: index, Status: BatchStatusRejected}
+
+	// null and other non-objects would decode into an empty event
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '{' {
+		result.Reason = "invalid event: not a JSON object"
+		return result, 0
+	}
+	var event models.Event
+	if err := json.Unmarshal(raw, &event); err != nil {
+		result.Reason = fmt.Sprintf("invalid event: %v", err)
+		return result, 0
+	}
+
+	duplicate, retryAfter, err := h.trackOnce(&event, app, r)
+	result.EventID = event.EventID
+	var schemaErr *schemaError
+	if errors.As(err, &schemaErr) {
+		result.Reason = schemaErr.Error()
+		return result, 0
+	}
+	if err != nil {
+		log.Printf("BatchPostHandler: failed to save event (app=%s, eventID=%s): %v", app.ID, event.EventID, err)
+		result.Reason = "failed to store event"
+		result.Retryable = true
+		return result, 0
+	}
+	if retryAfter > 0 {
+		result.Reason = "quota exceeded"
+		result.Retryable = true
+		return result, retryAfter
+	}
+
+	result.Status = BatchStatusAccepted
+	result.Duplicate = duplicate
+	return result, 0
+}
+
+// isNDJSON reports whether the request declares a newline-delimited JSON body.
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/x-ndjson" || mediaType == "application/ndjson"
+}
+
+// splitBatch splits a batch body into raw events. A body starting with '[' is
+// treated as a JSON array unless ndjson is set; otherwise every non-blank line is one event.
+// Lines are not validated here so that one bad line only rejects that event.
+func splitBatch(body []byte, ndjson bool) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("empty batch")
+	}
+
+	if !ndjson && trimmed[0] == '[' {
+		var raws []json.RawMessage
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %w", err)
+		}
+		return raws, nil
+	}
+
+	raws := make([]json.RawMessage, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 64*1024), MaxBatchBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		raws = append(raws, json.RawMessage(append([]byte(nil), line...)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read NDJSON: %w", err)
+	}
+	return raws, nil
+}
@@ -0,0 +1,428 @@
+package tracker
+
+import (
+	"analytics/apps"
+	"analytics/config"
+	"analytics/models"
+	"analytics/store"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		ndjson      bool
+		expectCount int
+		expectError bool
+	}{
+		{
+			name:        "json array",
+			body:        `[{"event_name":"a"},{"event_name":"b"}]`,
+			expectCount: 2,
+		},
+		{
+			name:        "ndjson with blank lines",
+			body:        "{\"event_name\":\"a\"}\n\n{\"event_name\":\"b\"}\n{\"event_name\":\"c\"}\n",
+			ndjson:      true,
+			expectCount: 3,
+		},
+		{
+			name:        "ndjson detected without content type",
+			body:        "{\"event_name\":\"a\"}\n{\"event_name\":\"b\"}",
+			expectCount: 2,
+		},
+		{
+			name:        "ndjson keeps bad lines for per-event rejection",
+			body:        "{\"event_name\":\"a\"}\nnot json\n",
+			ndjson:      true,
+			expectCount: 2,
+		},
+		{
+			name:        "malformed array",
+			body:        `[{"event_name":"a"},`,
+			expectError: true,
+		},
+		{
+			name:        "empty body",
+			body:        "   ",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raws, err := splitBatch([]byte(tt.body), tt.ndjson)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(raws) != tt.expectCount {
+				t.Errorf("Expected %d events, got %d", tt.expectCount, len(raws))
+			}
+		})
+	}
+}
+
+func TestBatchPostHandler(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+
+	appMgr, err := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer appMgr.Close()
+	app, err := appMgr.CreateApp("batch-app", nil, "owner-1", "")
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+	body := "{\"event_id\":\"e1\",\"event_name\":\"a\"}\nnot json\n{\"event_id\":\"e2\",\"event_name\":\"b\"}\n"
+	req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track/batch", strings.NewReader(body))
+	req.Header.Set("X-API-Key", app.Keys[0].Key)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+
+	tracker.BatchPostHandler()(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Accepted int           `json:"accepted"`
+		Rejected int           `json:"rejected"`
+		Results  []BatchResult `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Accepted != 2 || resp.Rejected != 1 {
+		t.Errorf("Expected 2 accepted and 1 rejected, got %d and %d", resp.Accepted, resp.Rejected)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(resp.Results))
+	}
+	if resp.Results[1].Status != BatchStatusRejected || resp.Results[1].Reason == "" {
+		t.Errorf("Expected second event rejected with a reason, got %+v", resp.Results[1])
+	}
+	if resp.Results[2].EventID != "e2" || resp.Results[2].Status != BatchStatusAccepted {
+		t.Errorf("Expected third event e2 accepted, got %+v", resp.Results[2])
+	}
+
+	// Array elements that are not objects are rejected rather than stored empty
+	req = httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track/batch", strings.NewReader(`[null,{"event_id":"e3","event_name":"c"},3]`))
+	req.Header.Set("X-API-Key", app.Keys[0].Key)
+	w = httptest.NewRecorder()
+	tracker.BatchPostHandler()(w, req)
+	resp.Results = nil
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Accepted != 1 || len(resp.Results) != 3 || resp.Results[0].Status != BatchStatusRejected || resp.Results[2].Status != BatchStatusRejected {
+		t.Errorf("Expected only e3 accepted, got %+v", resp.Results)
+	}
+	stored := 0
+	events.Scan(app.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(models.Event) error {
+		stored++
+		return nil
+	})
+	if stored != 3 {
+		t.Errorf("Expected e1, e2 and e3 stored, got %d events", stored)
+	}
+}
+
+func TestBatchPostHandlerRejectsMissingKey(t *testing.T) {
+	tracker, _ := NewEventTracker(nil, nil, config.IngestConfig{})
+	req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track/batch", strings.NewReader("[]"))
+	w := httptest.NewRecorder()
+
+	tracker.BatchPostHandler()(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+}
+
+func TestPostHandlerHidesInvalidKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// A revoked or mistyped key is still a secret
+	req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(`{"event_name":"a"}`))
+	req.Header.Set("X-API-Key", "revoked-secret-9f3a")
+	w := httptest.NewRecorder()
+	tracker.PostHandler()(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if strings.Contains(logs.String(), "revoked-secret") || !strings.Contains(logs.String(), "9f3a") {
+		t.Errorf("Expected only the key hint in logs, got %s", logs.String())
+	}
+}
+
+func TestPostHandlerLimits(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	app, _ := appMgr.CreateApp("limited-app", nil, "owner-1", "")
+
+	post := func(tracker *EventTracker, eventID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(`{"event_id":"`+eventID+`","event_name":"a"}`))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		w := httptest.NewRecorder()
+		tracker.PostHandler()(w, req)
+		return w
+	}
+
+	// Rate limit per key
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{KeyRatePerSecond: 1, KeyBurst: 2})
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := post(tracker, "r"+strconv.Itoa(i))
+		if w.Code != expected {
+			t.Errorf("Request %d: expected status %d, got %d", i, expected, w.Code)
+		}
+		if expected == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+			t.Errorf("Expected Retry-After 1, got %q", w.Header().Get("Retry-After"))
+		}
+	}
+
+	// Daily quota, of which the two events above used two
+	if err := appMgr.SetQuotas(app.ID, apps.Quotas{Daily: 3}); err != nil {
+		t.Fatalf("Failed to set quotas: %v", err)
+	}
+	unlimited, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+	if w := post(unlimited, "q1"); w.Code != http.StatusOK {
+		t.Errorf("Expected event within quota to be accepted, got %d", w.Code)
+	}
+	w := post(unlimited, "q2")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After over quota, got %d", w.Code)
+	}
+}
+
+func TestPostHandlerDeduplicates(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	app, _ := appMgr.CreateApp("dedup-app", nil, "owner-1", "")
+
+	cfg := config.IngestConfig{DedupWindowMinutes: 60, DedupMaxEntries: 100, DedupPath: filepath.Join(tempDir, "dedup.log")}
+	tracker, err := NewEventTracker(appMgr, events, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	defer tracker.Close()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(body))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		w := httptest.NewRecorder()
+		tracker.PostHandler()(w, req)
+		return w
+	}
+
+	first := post(`{"event_id":"dup-1","event_name":"a"}`)
+	second := post(`{"event_id":"dup-1","event_name":"a"}`)
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 twice, got %d and %d", first.Code, second.Code)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("Expected duplicate to get the original response, got %s and %s", first.Body.String(), second.Body.String())
+	}
+	post(`{"event_name":"no id"}`)
+	post(`{"event_name":"no id"}`)
+
+	stored := 0
+	events.Scan(app.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(models.Event) error {
+		stored++
+		return nil
+	})
+	if stored != 3 {
+		t.Errorf("Expected 3 stored events, got %d", stored)
+	}
+}
+
+func TestPostHandlerSchemaModes(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+	app, _ := appMgr.CreateApp("schema-app", nil, "owner-1", "")
+	appMgr.PutEventDefinition(app.ID, apps.EventDefinition{Name: "signup"})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(body))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		w := httptest.NewRecorder()
+		tracker.PostHandler()(w, req)
+		return w
+	}
+
+	appMgr.SetSchemaSettings(app.ID, apps.SchemaModeEnforce, nil)
+	if w := post(`{"event_type":"custom","event_name":"signup"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected valid event to be accepted, got %d", w.Code)
+	}
+	w := post(`{"event_type":"custom","evnt_name":"signup"}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `unknown event_name`) {
+		t.Errorf("Expected 422 with reason, got %d: %s", w.Code, w.Body.String())
+	}
+
+	appMgr.SetSchemaSettings(app.ID, apps.SchemaModeWarn, nil)
+	if w := post(`{"event_id":"warned","event_type":"custom","event_name":"sign_up"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected invalid event to be accepted in warn mode, got %d", w.Code)
+	}
+
+	var warned *models.Event
+	events.Scan(app.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(event models.Event) error {
+		if event.EventID == "warned" {
+			warned = &event
+		}
+		return nil
+	})
+	if warned == nil || len(warned.SchemaViolations) != 1 {
+		t.Errorf("Expected stored event tagged with its violation, got %+v", warned)
+	}
+
+	// Violations of events sent without an ID record the one the server assigned
+	if w := post(`{"event_type":"custom","event_name":"sign_up"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected invalid event to be accepted in warn mode, got %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps/"+app.ID+"/schema/violations", nil)
+	w = httptest.NewRecorder()
+	appMgr.SchemaViolationsHandler()(w, req)
+	var violations []apps.SchemaViolation
+	json.NewDecoder(w.Body).Decode(&violations)
+	if len(violations) == 0 || violations[0].EventID == "" || violations[0].EventID == "warned" {
+		t.Errorf("Expected the latest violation to carry the assigned event ID, got %+v", violations)
+	}
+}
+
+func TestPostHandlerDropsErasedUsers(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+	app, _ := appMgr.CreateApp("erasure-app", nil, "owner-1", "")
+	if _, err := appMgr.StartErasure(app.ID, apps.Erasure{UserID: "gone"}, "owner-1"); err != nil {
+		t.Fatalf("Failed to start erasure: %v", err)
+	}
+
+	for _, body := range []string{
+		`{"event_id":"late","event_name":"a","user":{"id":"gone"}}`,
+		`{"event_id":"kept","event_name":"a","user":{"id":"stays"}}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(body))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		w := httptest.NewRecorder()
+		tracker.PostHandler()(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+	}
+
+	var stored []string
+	events.Scan(app.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(event models.Event) error {
+		stored = append(stored, event.EventID)
+		return nil
+	})
+	if len(stored) != 1 || stored[0] != "kept" {
+		t.Errorf("Expected only the event of the other user to be stored, got %v", stored)
+	}
+}
+
+func TestPostHandlerIPLimitSparesKeyBudget(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	app, _ := appMgr.CreateApp("shared-key-app", nil, "owner-1", "")
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{KeyRatePerSecond: 0.001, KeyBurst: 3, IPRatePerSecond: 0.001, IPBurst: 1})
+
+	post := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(`{"event_name":"a"}`))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		tracker.PostHandler()(w, req)
+		return w.Code
+	}
+
+	// One client exhausts its own bucket and keeps trying
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if code := post("203.0.113.1:1000"); code != expected {
+			t.Errorf("Request %d from the abusive client: expected status %d, got %d", i, expected, code)
+		}
+	}
+	// The key still has budget for other clients
+	for _, addr := range []string{"203.0.113.2:1000", "203.0.113.3:1000"} {
+		if code := post(addr); code != http.StatusOK {
+			t.Errorf("Expected request from %s to be allowed, got %d", addr, code)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package tracker
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+
+	"analytics/models"
+)
+
+// Reasons an event is classified as coming from a bot, counted per app in its usage.
+const (
+	botReasonUserAgent  = "user_agent"
+	botReasonHeadless   = "headless"
+	botReasonDatacenter = "datacenter_ip"
+)
+
+// knownBotRanges are published crawler ranges. Config can add more, e.g.
+// cloud provider ranges from which uptime checkers run.
+var knownBotRanges = []string{
+	"66.249.64.0/19", // Googlebot
+	"157.55.39.0/24", // Bingbot
+	"207.46.13.0/24", // Bingbot
+	"40.77.167.0/24", // Bingbot
+}
+
+// headlessPattern matches automation tools that announce themselves.
+var headlessPattern = regexp.MustCompile(`HeadlessChrome|PhantomJS|Puppeteer|Playwright|Selenium|Cypress`)
+
+// botClassifier decides whether a web event was sent by a bot rather than a person.
+type botClassifier struct {
+	ranges []*net.IPNet
+}
+
+// newBotClassifier returns a classifier treating the known bot ranges and extra CIDRs as bots.
+func newBotClassifier(extra []string) (*botClassifier, error) {
+	c := &botClassifier{}
+	for _, cidr := range append(append([]string(nil), knownBotRanges...), extra...) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bot IP range %q: %w", cidr, err)
+		}
+		c.ranges = append(c.ranges, ipNet)
+	}
+	return c, nil
+}
+
+// classify returns why a web event looks like bot traffic, or "" if it does not.
+// Events of other platforms come from SDKs and are never classified.
+func (c *botClassifier) classify(event *models.Event, r *http.Request, clientIP string) string {
+	if event.Web == nil && event.Device.Platform != "web" {
+		return ""
+	}
+
+	userAgent := r.UserAgent()
+	if event.Web != nil && event.Web.UserAgent != "" {
+		userAgent = event.Web.UserAgent
+	}
+
+	switch {
+	case headlessPattern.MatchString(userAgent), headlessPattern.MatchString(r.Header.Get("Sec-CH-UA")):
+		return botReasonHeadless
+	case userAgent == "", botPattern.MatchString(userAgent):
+		return botReasonUserAgent
+	case c.inRanges(net.ParseIP(clientIP)):
+		return botReasonDatacenter
+	}
+	return ""
+}
+
+func (c *botClassifier) inRanges(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range c.ranges {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package tracker
+
+import (
+	"analytics/apps"
+	"analytics/config"
+	"analytics/models"
+	"analytics/store"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const chromeUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+func TestBotClassifier(t *testing.T) {
+	classifier, err := newBotClassifier([]string{"203.0.113.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		platform  string
+		userAgent string
+		headers   map[string]string
+		clientIP  string
+		expected  string
+	}{
+		{"browser", "web", chromeUA, map[string]string{"Accept-Language": "en"}, "198.51.100.7", ""},
+		{"crawler", "web", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", nil, "198.51.100.7", botReasonUserAgent},
+		{"uptime checker", "web", "curl/8.4.0", nil, "198.51.100.7", botReasonUserAgent},
+		{"headless chrome", "web", strings.Replace(chromeUA, "Chrome/", "HeadlessChrome/", 1), map[string]string{"Accept-Language": "en"}, "198.51.100.7", botReasonHeadless},
+		// Proxies and privacy tools strip it from real browsers too
+		{"no accept-language", "web", chromeUA, nil, "198.51.100.7", ""},
+		{"configured range", "web", chromeUA, map[string]string{"Accept-Language": "en"}, "203.0.113.9", botReasonDatacenter},
+		{"known crawler range", "web", chromeUA, map[string]string{"Accept-Language": "en"}, "66.249.66.1", botReasonDatacenter},
+		{"mobile sdk", "ios", "okhttp/4.12.0", nil, "198.51.100.7", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			event := &models.Event{Device: models.DeviceInfo{Platform: tt.platform}}
+
+			if got := classifier.classify(event, req, tt.clientIP); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBotPolicies(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+
+	count := func(storeID string) int {
+		n := 0
+		events.Scan(storeID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(event models.Event) error {
+			if event.IsBot {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+
+	tests := []struct {
+		policy     apps.BotPolicy
+		expectApp  int
+		expectBots int
+	}{
+		{apps.BotPolicyFlag, 1, 0},
+		{apps.BotPolicyDrop, 0, 0},
+		{apps.BotPolicySeparate, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			app, _ := appMgr.CreateApp("bots-"+string(tt.policy), nil, "owner-1", "")
+			update := httptest.NewRequest(http.MethodPut, "/analytics/api/v1/apps/"+app.ID, strings.NewReader(`{"name":"`+app.Name+`","bot_policy":"`+string(tt.policy)+`"}`))
+			updated := httptest.NewRecorder()
+			appMgr.UpdateAppHandler()(updated, update)
+			if updated.Code != http.StatusOK {
+				t.Fatalf("Failed to set bot policy: %d %s", updated.Code, updated.Body.String())
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(`{"event_name":"page","device":{"platform":"web"},"web_specific":{}}`))
+			req.Header.Set("X-API-Key", app.Keys[0].Key)
+			req.Header.Set("User-Agent", "curl/8.4.0")
+			w := httptest.NewRecorder()
+			tracker.PostHandler()(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			if got := count(app.ID); got != tt.expectApp {
+				t.Errorf("Expected %d bot events in app store, got %d", tt.expectApp, got)
+			}
+			if got := count(apps.BotsStoreID(app.ID)); got != tt.expectBots {
+				t.Errorf("Expected %d bot events in bots store, got %d", tt.expectBots, got)
+			}
+
+			usage := httptest.NewRecorder()
+			appMgr.UsageHandler()(usage, httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps/"+app.ID+"/usage", nil))
+			if !strings.Contains(usage.Body.String(), `"bots":{"user_agent":1}`) {
+				t.Errorf("Expected bot counted in usage, got %s", usage.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package tracker
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIPResolver finds the address of the client behind a chain of trusted
+// proxies. Forwarding headers are only believed when they were set by a
+// trusted proxy, since anyone else can write whatever they like into them.
+type clientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// newClientIPResolver returns a resolver trusting proxies in the given CIDRs.
+func newClientIPResolver(cidrs []string) (*clientIPResolver, error) {
+	c := &clientIPResolver{}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		c.trusted = append(c.trusted, ipNet)
+	}
+	return c, nil
+}
+
+func (c *clientIPResolver) isTrusted(ip net.IP) bool {
+	for _, ipNet := range c.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the client IP of a request. Starting from the connection's
+// peer, it walks the forwarding chain right to left while hops are trusted
+// proxies, and returns the first untrusted hop. The chain is read from the
+// Forwarded header if present, else from X-Forwarded-For, else X-Real-IP.
+func (c *clientIPResolver) resolve(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !c.isTrusted(peer) {
+		return host
+	}
+
+	hops := forwardedFor(r.Header.Values("Forwarded"))
+	if hops == nil {
+		hops = splitList(r.Header.Values("X-Forwarded-For"))
+	}
+	if hops == nil {
+		if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+			hops = []string{xri}
+		}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(hops[i])
+		if hop == nil {
+			// Obfuscated or garbled, so the proxy that wrote it is as close as we get
+			break
+		}
+		client = hop
+		if !c.isTrusted(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedFor returns the for= nodes of RFC 7239 Forwarded headers, in order,
+// or nil if there are none. Ports and IPv6 brackets are stripped; obfuscated
+// identifiers such as "unknown" or "_hidden" are kept, so they stop the walk.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range splitList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || !strings.EqualFold(name, "for") {
+				continue
+			}
+			hops = append(hops, forwardedNode(strings.Trim(value, `"`)))
+		}
+	}
+	return hops
+}
+
+// forwardedNode strips the port from a Forwarded node, e.g. "[2001:db8::1]:4711" or "192.0.2.60:80".
+func forwardedNode(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return node
+}
+
+// splitList splits comma-separated header values into trimmed, non-empty items.
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,86 @@
+package tracker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := newClientIPResolver([]string{"127.0.0.1/32", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "198.51.100.7:5000",
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "spoofed header from untrusted peer",
+			remoteAddr: "198.51.100.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "behind proxy",
+			remoteAddr: "127.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "spoofed first entry behind proxy",
+			remoteAddr: "127.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.1.2.3"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "all hops trusted",
+			remoteAddr: "127.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.5, 10.1.2.3"},
+			expected:   "10.0.0.5",
+		},
+		{
+			name:       "x-real-ip behind proxy",
+			remoteAddr: "127.0.0.1:5000",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.7"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "forwarded header preferred",
+			remoteAddr: "127.0.0.1:5000",
+			headers: map[string]string{
+				"Forwarded":       `for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https, for=10.1.2.3:80`,
+				"X-Forwarded-For": "203.0.113.9",
+			},
+			expected: "2001:db8:cafe::17",
+		},
+		{
+			name:       "obfuscated hop",
+			remoteAddr: "127.0.0.1:5000",
+			headers:    map[string]string{"Forwarded": "for=unknown, for=10.1.2.3"},
+			expected:   "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			if got := resolver.resolve(req); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
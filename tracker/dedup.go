@@ -0,0 +1,241 @@
+package tracker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dedupCompactSlack is how many stale journal lines are tolerated before the journal is rewritten.
+const dedupCompactSlack = 10000
+
+type dedupKey struct {
+	appID   string
+	eventID string
+}
+
+// dedupEntry is an ID in the index. It is journaled once committed; until then
+// its event is being stored and the ID is only claimed.
+type dedupEntry struct {
+	accepted  time.Time
+	committed bool
+}
+
+// dedupRecord is one line of the dedup journal.
+type dedupRecord struct {
+	AppID    string `json:"a"`
+	EventID  string `json:"e"`
+	Accepted int64  `json:"t"` // unix nanoseconds
+}
+
+// dedupIndex remembers the event IDs accepted per app within a window, so
+// retried events are not stored twice. It holds at most maxEntries IDs, evicting
+// the oldest first, and journals accepted IDs to a file to survive restarts.
+// A nil *dedupIndex deduplicates nothing.
+type dedupIndex struct {
+	mu           sync.Mutex
+	window       time.Duration
+	maxEntries   int
+	entries      map[dedupKey]dedupEntry // accepted or in-flight IDs
+	order        []dedupRecord           // entries oldest first, may hold released IDs
+	path         string
+	journal      *os.File
+	journalLines int
+}
+
+// newDedupIndex loads the journal at path, keeping IDs accepted within window.
+// It returns nil if window is not positive.
+func newDedupIndex(path string, window time.Duration, maxEntries int) (*dedupIndex, error) {
+	if window <= 0 {
+		return nil, nil
+	}
+
+	d := &dedupIndex{
+		window:     window,
+		maxEntries: maxEntries,
+		entries:    make(map[dedupKey]dedupEntry),
+		path:       path,
+	}
+	if err := d.load(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := d.compact(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *dedupIndex) load(now time.Time) error {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open dedup journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record dedupRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A torn last line from a crash, nothing to dedup against
+			log.Printf("dedupIndex: Skipping invalid journal line: %v", err)
+			continue
+		}
+		d.insert(record, true)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read dedup journal: %w", err)
+	}
+	d.evict(now)
+	return nil
+}
+
+// insert adds a record to the index. The caller must hold mu.
+func (d *dedupIndex) insert(record dedupRecord, committed bool) {
+	d.entries[dedupKey{record.AppID, record.EventID}] = dedupEntry{accepted: time.Unix(0, record.Accepted), committed: committed}
+	d.order = append(d.order, record)
+}
+
+// evict drops entries older than the window, then the oldest ones beyond maxEntries.
+// The caller must hold mu.
+func (d *dedupIndex) evict(now time.Time) {
+	cutoff := now.Add(-d.window).UnixNano()
+	drop := 0
+	for drop < len(d.order) && (d.order[drop].Accepted < cutoff || len(d.entries) > d.maxEntries) {
+		record := d.order[drop]
+		key := dedupKey{record.AppID, record.EventID}
+		if entry, ok := d.entries[key]; ok && entry.accepted.UnixNano() == record.Accepted {
+			delete(d.entries, key)
+		}
+		drop++
+	}
+	if drop > 0 {
+		d.order = append(d.order[:0:0], d.order[drop:]...)
+	}
+}
+
+// claim reserves an event ID for an app. It returns false if the ID was
+// already accepted within the window or is being tracked by another request.
+// A claim must be followed by commit or release.
+func (d *dedupIndex) claim(appID, eventID string, now time.Time) bool {
+	if d == nil || eventID == "" {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dedupKey{appID, eventID}
+	if entry, exists := d.entries[key]; exists && now.Sub(entry.accepted) < d.window {
+		return false
+	}
+	d.insert(dedupRecord{AppID: appID, EventID: eventID, Accepted: now.UnixNano()}, false)
+	d.evict(now)
+	return true
+}
+
+// release forgets a claimed event ID whose event was not stored, so a retry is accepted.
+func (d *dedupIndex) release(appID, eventID string) {
+	if d == nil || eventID == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, dedupKey{appID, eventID})
+}
+
+// commit journals a claimed event ID once its event is stored.
+func (d *dedupIndex) commit(appID, eventID string) {
+	if d == nil || eventID == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dedupKey{appID, eventID}
+	entry, exists := d.entries[key]
+	if !exists {
+		return // evicted meanwhile
+	}
+	entry.committed = true
+	d.entries[key] = entry
+	line, _ := json.Marshal(dedupRecord{AppID: appID, EventID: eventID, Accepted: entry.accepted.UnixNano()})
+	if _, err := d.journal.Write(append(line, '\n')); err != nil {
+		log.Printf("dedupIndex: Failed to write journal: %v", err)
+		return
+	}
+	d.journalLines++
+
+	if d.journalLines > len(d.entries)+dedupCompactSlack {
+		if err := d.compact(); err != nil {
+			log.Printf("dedupIndex: Failed to compact journal: %v", err)
+		}
+	}
+}
+
+// compact rewrites the journal with only the live committed entries and reopens
+// it for appending. Claims still in flight are journaled by their commit.
+// The caller must hold mu, or own d exclusively.
+func (d *dedupIndex) compact() error {
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return fmt.Errorf("create dedup directory: %w", err)
+	}
+
+	tmp := d.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create dedup journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	lines := 0
+	for _, record := range d.order {
+		entry, ok := d.entries[dedupKey{record.AppID, record.EventID}]
+		if !ok || !entry.committed || entry.accepted.UnixNano() != record.Accepted {
+			continue
+		}
+		line, _ := json.Marshal(record)
+		w.Write(append(line, '\n'))
+		lines++
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("write dedup journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write dedup journal: %w", err)
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return fmt.Errorf("replace dedup journal: %w", err)
+	}
+
+	journal, err := os.OpenFile(d.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open dedup journal: %w", err)
+	}
+	if d.journal != nil {
+		d.journal.Close()
+	}
+	d.journal = journal
+	d.journalLines = lines
+	return nil
+}
+
+// close closes the journal.
+func (d *dedupIndex) close() error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.journal.Close()
+}
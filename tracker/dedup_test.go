@@ -0,0 +1,97 @@
+package tracker
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDedupIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	index, err := newDedupIndex(path, time.Hour, 2)
+	if err != nil {
+		t.Fatalf("Failed to create dedup index: %v", err)
+	}
+	now := time.Now()
+
+	if !index.claim("app", "e1", now) {
+		t.Fatal("Expected first claim to succeed")
+	}
+	if index.claim("app", "e1", now) {
+		t.Errorf("Expected in-flight event ID to be claimed once")
+	}
+	index.commit("app", "e1")
+	if index.claim("app", "e1", now.Add(time.Minute)) {
+		t.Errorf("Expected accepted event ID to be a duplicate")
+	}
+	if !index.claim("other-app", "e1", now) {
+		t.Errorf("Expected event IDs to be deduplicated per app")
+	}
+	index.release("other-app", "e1")
+	if !index.claim("other-app", "e1", now) {
+		t.Errorf("Expected released event ID to be claimable again")
+	}
+	index.commit("other-app", "e1")
+	index.close()
+
+	// The journal survives a restart
+	reloaded, err := newDedupIndex(path, time.Hour, 2)
+	if err != nil {
+		t.Fatalf("Failed to reload dedup index: %v", err)
+	}
+	if reloaded.claim("app", "e1", now.Add(time.Minute)) {
+		t.Errorf("Expected event ID to be a duplicate after restart")
+	}
+
+	// Past the window the event ID is accepted again
+	if !reloaded.claim("app", "e2", now.Add(2*time.Hour)) {
+		t.Errorf("Expected event ID past the window to be accepted")
+	}
+
+	// The index is bounded, forgetting the oldest IDs first
+	reloaded.claim("app", "e3", now.Add(2*time.Hour))
+	reloaded.claim("app", "e4", now.Add(2*time.Hour))
+	if len(reloaded.entries) > 2 {
+		t.Errorf("Expected at most 2 entries, got %d", len(reloaded.entries))
+	}
+	if !reloaded.claim("app", "e2", now.Add(2*time.Hour)) {
+		t.Errorf("Expected evicted event ID to be accepted again")
+	}
+	reloaded.close()
+}
+
+func TestDedupIndexCompactSkipsClaims(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.log")
+	index, _ := newDedupIndex(path, time.Hour, 10)
+	now := time.Now()
+
+	index.claim("app", "stored", now)
+	index.commit("app", "stored")
+	index.claim("app", "in-flight", now)
+	index.claim("app", "committed-late", now)
+	if err := index.compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	index.commit("app", "committed-late")
+	// The process dies before the in-flight event is stored
+	index.close()
+
+	reloaded, _ := newDedupIndex(path, time.Hour, 10)
+	defer reloaded.close()
+	if reloaded.claim("app", "stored", now) || reloaded.claim("app", "committed-late", now) {
+		t.Errorf("Expected committed event IDs to be duplicates after restart")
+	}
+	if !reloaded.claim("app", "in-flight", now) {
+		t.Errorf("Expected the retry of an uncommitted event to be accepted after restart")
+	}
+}
+
+func TestDedupIndexDisabled(t *testing.T) {
+	index, err := newDedupIndex("", 0, 0)
+	if err != nil || index != nil {
+		t.Fatalf("Expected nil index when disabled, got %v, %v", index, err)
+	}
+	if !index.claim("app", "e1", time.Now()) || !index.claim("app", "e1", time.Now()) {
+		t.Errorf("Expected disabled index to accept everything")
+	}
+}
@@ -0,0 +1,83 @@
+package tracker
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"analytics/apps"
+	"analytics/models"
+)
+
+// applyPrivacy rewrites the stored client IP of an event according to the app's
+// IP mode. It runs after enrichment so the GeoIP lookup still sees the full IP.
+func (h *EventTracker) applyPrivacy(event *models.Event, appID string, privacy apps.Privacy) {
+	if event.Location == nil || event.Location.IP == "" {
+		return
+	}
+	event.Location.IP = h.maskIP(event.Location.IP, appID, privacy)
+}
+
+// maskIP applies the app's IP mode to a client IP. It returns "" if the IP is
+// not kept at all.
+func (h *EventTracker) maskIP(ip, appID string, privacy apps.Privacy) string {
+	if h.dropIP {
+		return ""
+	}
+
+	switch privacy.IPMode {
+	case apps.IPModeTruncate:
+		return truncateIP(ip, *privacy.IPv4Prefix, *privacy.IPv6Prefix)
+	case apps.IPModeHash:
+		return h.salt.hash(time.Now(), "ip", appID, ip)
+	case apps.IPModeDrop:
+		return ""
+	}
+	return ip
+}
+
+// logIP returns the client IP of a request to an app as it may be logged: masked
+// like the IPs stored with the app's events, so the logs keep no more. Before
+// the app is known it is truncated to the default prefix lengths.
+func (h *EventTracker) logIP(clientIP string, app *apps.App) string {
+	var masked string
+	switch {
+	case app != nil:
+		masked = h.maskIP(clientIP, app.ID, h.appMgr.Privacy(app.ID))
+	case !h.dropIP:
+		masked = truncateIP(clientIP, apps.DefaultIPv4Prefix, apps.DefaultIPv6Prefix)
+	}
+	if masked != "" {
+		return masked
+	}
+	return "-"
+}
+
+// deriveVisitorID sets the anonymous ID of an event sent without one to a hash of
+// the client IP and user agent under the daily salt. The same browser gets the
+// same ID all day, and an unrelated one the next day once the salt is discarded.
+func (h *EventTracker) deriveVisitorID(event *models.Event, appID string, r *http.Request) {
+	if event.User.AnonymousID != "" {
+		return
+	}
+
+	userAgent := r.UserAgent()
+	if event.Web != nil && event.Web.UserAgent != "" {
+		userAgent = event.Web.UserAgent
+	}
+	event.User.AnonymousID = h.salt.hash(time.Now(), "visitor", appID, h.clientIP(r), userAgent)
+	event.User.AnonymousIDDerived = true
+}
+
+// truncateIP zeroes the host bits of an address beyond the prefix length of its
+// family. Addresses that do not parse are dropped rather than stored whole.
+func truncateIP(addr string, ipv4Prefix, ipv6Prefix int) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(ipv4Prefix, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(ipv6Prefix, 128)).String()
+}
@@ -0,0 +1,345 @@
+package tracker
+
+import (
+	"analytics/apps"
+	"analytics/config"
+	fba "analytics/firebase_auth"
+	"analytics/models"
+	"analytics/store"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTruncateIP(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"203.0.113.77", "203.0.113.0"},
+		{"2001:db8:1234:5678::1", "2001:db8:1234::"},
+		{"::ffff:203.0.113.77", "203.0.113.0"},
+		{"not an ip", ""},
+	}
+
+	for _, tt := range tests {
+		if got := truncateIP(tt.addr, 24, 48); got != tt.expected {
+			t.Errorf("truncateIP(%s): expected %q, got %q", tt.addr, tt.expected, got)
+		}
+	}
+}
+
+func TestIPModes(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+
+	created := 0
+	storedIP := func(privacy string) string {
+		created++
+		name := fmt.Sprintf("privacy-%d", created)
+		app, _ := appMgr.CreateApp(name, nil, "owner-1", "")
+		update := httptest.NewRequest(http.MethodPut, "/analytics/api/v1/apps/"+app.ID, strings.NewReader(`{"name":"`+name+`","privacy":`+privacy+`}`))
+		updated := httptest.NewRecorder()
+		appMgr.UpdateAppHandler()(updated, update)
+		if updated.Code != http.StatusOK {
+			t.Fatalf("Failed to set privacy: %d %s", updated.Code, updated.Body.String())
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(`{"event_name":"a"}`))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		req.RemoteAddr = "203.0.113.77:4321"
+		tracker.PostHandler()(httptest.NewRecorder(), req)
+
+		var ip string
+		events.Scan(app.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(event models.Event) error {
+			ip = event.Location.IP
+			return nil
+		})
+		return ip
+	}
+
+	if ip := storedIP(`{"ip_mode":"full"}`); ip != "203.0.113.77" {
+		t.Errorf("Expected full IP, got %q", ip)
+	}
+	if ip := storedIP(`{"ip_mode":"truncate"}`); ip != "203.0.113.0" {
+		t.Errorf("Expected truncated IP, got %q", ip)
+	}
+	if ip := storedIP(`{"ip_mode":"truncate","ipv4_prefix":16}`); ip != "203.0.0.0" {
+		t.Errorf("Expected IP truncated to /16, got %q", ip)
+	}
+	// A prefix of 0 keeps no bits rather than falling back to the default
+	if ip := storedIP(`{"ip_mode":"truncate","ipv4_prefix":0}`); ip != "0.0.0.0" {
+		t.Errorf("Expected IP truncated to /0, got %q", ip)
+	}
+	if ip := storedIP(`{"ip_mode":"drop"}`); ip != "" {
+		t.Errorf("Expected no IP, got %q", ip)
+	}
+	if ip := storedIP(`{"ip_mode":"hash"}`); len(ip) != 32 || strings.Contains(ip, "203.0.113") {
+		t.Errorf("Expected hashed IP, got %q", ip)
+	}
+}
+
+func TestDailySalt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "salt.json")
+	salt, err := newDailySalt(path)
+	if err != nil {
+		t.Fatalf("Failed to create salt: %v", err)
+	}
+	day := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	first := salt.hash(day, "ip", "app", "203.0.113.77")
+	if again := salt.hash(day.Add(time.Hour), "ip", "app", "203.0.113.77"); again != first {
+		t.Errorf("Expected the same hash within a day")
+	}
+
+	// The salt survives a restart within the day
+	reloaded, _ := newDailySalt(path)
+	if again := reloaded.hash(day, "ip", "app", "203.0.113.77"); again != first {
+		t.Errorf("Expected the same hash after reload")
+	}
+
+	if next := reloaded.hash(day.Add(24*time.Hour), "ip", "app", "203.0.113.77"); next == first {
+		t.Errorf("Expected a different hash the next day")
+	}
+}
+
+func TestLogsFollowIPMode(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+	app, _ := appMgr.CreateApp("quiet-logs", nil, "owner-1", "")
+	appMgr.SetPrivacy(app.ID, apps.Privacy{IPMode: apps.IPModeDrop})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for _, body := range []string{`{"event_name":"a","properties":{"email":"jane@example.com"}}`, `{not json`} {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(body))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		req.RemoteAddr = "203.0.113.77:4321"
+		tracker.PostHandler()(httptest.NewRecorder(), req)
+	}
+
+	if strings.Contains(logs.String(), "203.0.113") {
+		t.Errorf("Expected no client IP in logs, got %s", logs.String())
+	}
+	if strings.Contains(logs.String(), "jane@example.com") {
+		t.Errorf("Expected no event body in logs, got %s", logs.String())
+	}
+
+	// Before the app is known the IP is truncated
+	logs.Reset()
+	for _, key := range []string{"", "wrong-key-0000"} {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			req := httptest.NewRequest(method, "/analytics/api/v1/track", strings.NewReader(`{}`))
+			req.Header.Set("X-API-Key", key)
+			req.RemoteAddr = "203.0.113.77:4321"
+			tracker.PostHandler()(httptest.NewRecorder(), req)
+		}
+	}
+	if strings.Contains(logs.String(), "203.0.113.77") || !strings.Contains(logs.String(), "203.0.113.0") {
+		t.Errorf("Expected only truncated client IPs in logs, got %s", logs.String())
+	}
+}
+
+func TestCookielessVisitors(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+	app, _ := appMgr.CreateApp("cookieless", nil, "owner-1", "")
+	appMgr.SetPrivacy(app.ID, apps.Privacy{CookielessVisitors: true, IPMode: apps.IPModeDrop})
+
+	post := func(body, remoteAddr, userAgent string) {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(body))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		req.Header.Set("User-Agent", userAgent)
+		req.RemoteAddr = remoteAddr
+		tracker.PostHandler()(httptest.NewRecorder(), req)
+	}
+	post(`{"event_name":"a"}`, "203.0.113.77:1000", "browser-a")
+	post(`{"event_name":"b"}`, "203.0.113.77:2000", "browser-a")
+	post(`{"event_name":"c"}`, "203.0.113.77:3000", "browser-b")
+	post(`{"event_name":"d","user":{"anonymous_id":"sent"}}`, "203.0.113.77:4000", "browser-a")
+
+	ids := make(map[string]string)
+	events.Scan(app.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(event models.Event) error {
+		ids[event.EventName] = event.User.AnonymousID
+		return nil
+	})
+
+	if ids["a"] == "" || ids["a"] != ids["b"] {
+		t.Errorf("Expected the same derived ID for one visitor, got %q and %q", ids["a"], ids["b"])
+	}
+	if ids["c"] == ids["a"] {
+		t.Errorf("Expected a different ID for another user agent")
+	}
+	if ids["d"] != "sent" {
+		t.Errorf("Expected sent anonymous ID to be kept, got %q", ids["d"])
+	}
+}
+
+func TestExportSkipsDerivedVisitorIDs(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+	app, _ := appMgr.CreateApp("shared-nat", nil, "owner-1", "")
+	appMgr.SetPrivacy(app.ID, apps.Privacy{CookielessVisitors: true})
+
+	// Two users behind one IP with the same browser get the same derived ID
+	for _, body := range []string{
+		`{"event_name":"login","user":{"id":"u1","session_id":"s1"}}`,
+		`{"event_name":"browse","user":{"session_id":"s1"}}`,
+		`{"event_name":"other","user":{"session_id":"s2"}}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(body))
+		req.Header.Set("X-API-Key", app.Keys[0].Key)
+		req.Header.Set("User-Agent", "browser-a")
+		req.RemoteAddr = "203.0.113.77:1000"
+		tracker.PostHandler()(httptest.NewRecorder(), req)
+	}
+
+	export, err := apps.BuildExport(events, app.ID, apps.Subject{UserID: "u1"})
+	if err != nil {
+		t.Fatalf("Failed to build export: %v", err)
+	}
+	var names []string
+	for _, event := range export.Events {
+		names = append(names, event.EventName)
+	}
+	if len(names) != 2 || names[0] != "login" || names[1] != "browse" {
+		t.Errorf("Expected only the events of u1, got %v", names)
+	}
+}
+
+func TestRedactionAtIngestion(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	appMgr, _ := apps.NewManager(filepath.Join(tempDir, "app-metadata.json"), events, config.AppsConfig{})
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+	app, _ := appMgr.CreateApp("redacted", nil, "owner-1", "")
+	appMgr.SetRedaction(app.ID, apps.Redaction{Detectors: []apps.Detector{apps.DetectorEmail}, QueryParams: []string{"session"}})
+
+	// The referrer is filled from the request header, so it must be scrubbed after enrichment
+	body := `{"event_name":"signup","device":{"platform":"web"},"web_specific":{"page_url":"https://example.com/?session=s1"},"properties":{"email":"jane@example.com"}}`
+	req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(body))
+	req.Header.Set("X-API-Key", app.Keys[0].Key)
+	req.Header.Set("Referer", "https://mail.example.com/?to=jane%40example.com")
+	w := httptest.NewRecorder()
+	tracker.PostHandler()(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var stored *models.Event
+	events.Scan(app.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(event models.Event) error {
+		stored = &event
+		return nil
+	})
+	if stored == nil {
+		t.Fatal("Expected the event to be stored")
+	}
+	if stored.Properties["email"] != apps.Redacted {
+		t.Errorf("Expected email property redacted, got %v", stored.Properties["email"])
+	}
+	if stored.Web.PageURL != "https://example.com/" {
+		t.Errorf("Expected session parameter stripped, got %q", stored.Web.PageURL)
+	}
+	if strings.Contains(stored.Web.Referrer, "jane") {
+		t.Errorf("Expected email redacted from referrer, got %q", stored.Web.Referrer)
+	}
+
+	// The catalogue samples the redacted value
+	req = httptest.NewRequest(http.MethodGet, "/analytics/api/v1/apps/"+app.ID+"/schema", nil)
+	req = req.WithContext(context.WithValue(req.Context(), fba.UserIDKey, "owner-1"))
+	w = httptest.NewRecorder()
+	appMgr.CrudHandler()(w, req)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "jane") || !strings.Contains(w.Body.String(), apps.Redacted) {
+		t.Errorf("Expected only the redacted email sampled, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestInvalidRedactionRejectsEvents(t *testing.T) {
+	tempDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(oldWd)
+
+	events := store.NewFileStore(store.DefaultDataDir)
+	defer events.Close()
+	metadataPath := filepath.Join(tempDir, "app-metadata.json")
+	appMgr, _ := apps.NewManager(metadataPath, events, config.AppsConfig{})
+	app, _ := appMgr.CreateApp("corrupted", nil, "owner-1", "")
+	appMgr.SetRedaction(app.ID, apps.Redaction{Patterns: []apps.RedactionPattern{{Name: "ticket", Pattern: "T-[0-9]+"}}})
+	appMgr.Close()
+
+	// A hand edit breaks the pattern, which is only noticed once events arrive
+	metadata, _ := os.ReadFile(metadataPath)
+	os.WriteFile(metadataPath, []byte(strings.Replace(string(metadata), "T-[0-9]+", "T-[0-9", 1)), 0644)
+	appMgr, err := apps.NewManager(metadataPath, events, config.AppsConfig{})
+	if err != nil {
+		t.Fatalf("Failed to reload manager: %v", err)
+	}
+	defer appMgr.Close()
+	tracker, _ := NewEventTracker(appMgr, events, config.IngestConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/analytics/api/v1/track", strings.NewReader(`{"event_name":"support","properties":{"ticket":"T-123"}}`))
+	req.Header.Set("X-API-Key", app.Keys[0].Key)
+	w := httptest.NewRecorder()
+	tracker.PostHandler()(w, req)
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected the event to be refused, got status %d", w.Code)
+	}
+
+	stored := 0
+	events.Scan(app.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(event models.Event) error {
+		stored++
+		return nil
+	})
+	if stored != 0 {
+		t.Errorf("Expected no event stored unredacted, got %d", stored)
+	}
+}
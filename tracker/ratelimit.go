@@ -0,0 +1,106 @@
+package tracker
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket holds the tokens of one client, refilled continuously up to the burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a set of token buckets keyed by client, e.g. API key or IP.
+// A nil *rateLimiter allows everything.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newRateLimiter returns a limiter refilling rate tokens per second up to burst,
+// or nil if rate is not positive.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// take removes n tokens from the bucket of key. If there are not enough it
+// takes none and returns how long until there will be. Requests costing more
+// than the burst are charged the burst, so they can succeed from a full bucket.
+func (l *rateLimiter) take(key string, n int, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	cost := math.Min(float64(n), l.burst)
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rate)
+		bucket.last = now
+	}
+
+	if bucket.tokens < cost {
+		wait := (cost - bucket.tokens) / l.rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	bucket.tokens -= cost
+	return true, 0
+}
+
+// refund returns n tokens taken from the bucket of key, for requests that
+// were refused by another limiter after this one let them through.
+func (l *rateLimiter) refund(key string, n int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bucket, exists := l.buckets[key]; exists {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+math.Min(float64(n), l.burst))
+	}
+}
+
+// sweep drops buckets idle long enough to have refilled, which behave like new ones.
+// The caller must hold mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(10, 5) // 10 events/s, burst 5
+	now := time.Date(2025, 8, 24, 12, 0, 0, 0, time.UTC)
+
+	if ok, _ := limiter.take("key", 5, now); !ok {
+		t.Fatal("Expected full bucket to allow the burst")
+	}
+	ok, retryAfter := limiter.take("key", 1, now)
+	if ok {
+		t.Fatal("Expected empty bucket to refuse")
+	}
+	if retryAfter != 100*time.Millisecond {
+		t.Errorf("Expected retry after 100ms, got %s", retryAfter)
+	}
+
+	// Other clients have their own bucket
+	if ok, _ := limiter.take("other", 1, now); !ok {
+		t.Errorf("Expected another key to be allowed")
+	}
+
+	// Refills over time, up to the burst
+	if ok, _ := limiter.take("key", 2, now.Add(200*time.Millisecond)); !ok {
+		t.Errorf("Expected refilled tokens to be allowed")
+	}
+	if ok, _ := limiter.take("key", 1, now.Add(200*time.Millisecond)); ok {
+		t.Errorf("Expected bucket to be empty again")
+	}
+
+	// Requests larger than the burst are charged the burst
+	if ok, _ := limiter.take("big", 100, now); !ok {
+		t.Errorf("Expected oversized request from a full bucket to be allowed")
+	}
+
+	// Disabled limiters allow everything
+	var disabled *rateLimiter = newRateLimiter(0, 0)
+	if ok, _ := disabled.take("key", 1000, now); !ok {
+		t.Errorf("Expected disabled limiter to allow")
+	}
+}
@@ -0,0 +1,108 @@
+package tracker
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dailySalt is a random secret replaced every UTC day. It is persisted so
+// restarts within a day keep it; earlier salts are discarded, so hashes of
+// earlier days can neither be recomputed nor linked to today's.
+type dailySalt struct {
+	mu   sync.Mutex
+	path string // "" keeps the salt in memory only
+	day  string
+	salt []byte
+}
+
+// saltFile is the persisted form of a dailySalt.
+type saltFile struct {
+	Day  string `json:"day"` // YYYYMMDD
+	Salt []byte `json:"salt"`
+}
+
+// newDailySalt loads the salt at path, if any.
+func newDailySalt(path string) (*dailySalt, error) {
+	s := &dailySalt{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read salt: %w", err)
+	}
+	var stored saltFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("parse salt: %w", err)
+	}
+	s.day, s.salt = stored.Day, stored.Salt
+	return s, nil
+}
+
+// current returns the salt of the UTC day of now, generating it on the first call of the day.
+func (s *dailySalt) current(now time.Time) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := now.UTC().Format("20060102")
+	if day == s.day && len(s.salt) > 0 {
+		return s.salt
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		panic(fmt.Sprintf("generate salt: %v", err))
+	}
+	s.day, s.salt = day, salt
+	if err := s.save(); err != nil {
+		// Only costs continuity of hashes across a restart today
+		log.Printf("dailySalt: Failed to save salt: %v", err)
+	}
+	return salt
+}
+
+// save writes the salt. The caller must hold mu.
+func (s *dailySalt) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(saltFile{Day: s.day, Salt: s.salt})
+	if err != nil {
+		return fmt.Errorf("marshal salt: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("create salt directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write salt: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("write salt: %w", err)
+	}
+	return nil
+}
+
+// hash returns a keyed hash of the parts under the salt of now, as 32 hex characters.
+func (s *dailySalt) hash(now time.Time, parts ...string) string {
+	mac := hmac.New(sha256.New, s.current(now))
+	for _, part := range parts {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -2,80 +2,140 @@ package tracker
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"analytics/apps"
+	"analytics/config"
+	"analytics/geoip"
 	"analytics/models"
+	"analytics/store"
 
 	"github.com/google/uuid"
 )
 
 type EventTracker struct {
-	appMgr *apps.Manager
+	appMgr     *apps.Manager
+	events     store.EventStore
+	keyLimiter *rateLimiter // per API key, nil if disabled
+	ipLimiter  *rateLimiter // per client IP, nil if disabled
+	dedup      *dedupIndex  // accepted event IDs, nil if disabled
+	geo        *geoip.Locator
+	dropIP     bool
+	bots       *botClassifier
+	salt       *dailySalt
+	proxies    *clientIPResolver
 }
 
-func NewEventTracker(appMgr *apps.Manager) *EventTracker {
-	return &EventTracker{
-		appMgr: appMgr,
+func NewEventTracker(appMgr *apps.Manager, events store.EventStore, cfg config.IngestConfig) (_ *EventTracker, err error) {
+	dedup, err := newDedupIndex(cfg.DedupPath, time.Duration(cfg.DedupWindowMinutes)*time.Minute, cfg.DedupMaxEntries)
+	if err != nil {
+		return nil, fmt.Errorf("load dedup index: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			dedup.close()
+		}
+	}()
+
+	bots, err := newBotClassifier(cfg.BotIPRanges)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := newClientIPResolver(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := newDailySalt(cfg.SaltPath)
+	if err != nil {
+		return nil, fmt.Errorf("load salt: %w", err)
+	}
+	geo, err := geoip.Open(cfg.GeoIPPath)
+	if err != nil {
+		return nil, fmt.Errorf("load GeoIP database: %w", err)
 	}
+
+	return &EventTracker{
+		appMgr:     appMgr,
+		events:     events,
+		keyLimiter: newRateLimiter(cfg.KeyRatePerSecond, cfg.KeyBurst),
+		ipLimiter:  newRateLimiter(cfg.IPRatePerSecond, cfg.IPBurst),
+		dedup:      dedup,
+		geo:        geo,
+		dropIP:     cfg.DropIP,
+		bots:       bots,
+		salt:       salt,
+		proxies:    proxies,
+	}, nil
+}
+
+// Close closes the dedup journal and stops watching the GeoIP database.
+func (h *EventTracker) Close() error {
+	h.geo.Close()
+	return h.dedup.close()
 }
 
 func (h *EventTracker) PostHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		clientIP := extractClientIP(r)
-		log.Printf("PostHandler: %s %s from %s", r.Method, r.URL.Path, clientIP)
-
-		if r.Method != http.MethodPost {
-			log.Printf("PostHandler: method not allowed: %s from %s", r.Method, clientIP)
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
+		clientIP := h.clientIP(r)
+		log.Printf("PostHandler: %s %s", r.Method, r.URL.Path)
 
-		apiKey := r.Header.Get("X-API-Key")
-		if apiKey == "" {
-			log.Printf("PostHandler: missing API key from %s", clientIP)
-			w.WriteHeader(http.StatusUnauthorized)
+		app, ok := h.authorizePost(w, r, "PostHandler", clientIP)
+		if !ok {
 			return
 		}
-
-		app, err := h.appMgr.GetAppByAPIKey(apiKey)
-		if err != nil {
-			log.Printf("PostHandler: invalid API key (%s) from %s", apiKey, clientIP)
-			w.WriteHeader(http.StatusUnauthorized)
+		logIP := h.logIP(clientIP, app)
+		if !h.limitRate(w, r, "PostHandler", app, clientIP, 1) {
 			return
 		}
 
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			log.Printf("PostHandler: failed to read body from %s (app=%s): %v", clientIP, app.ID, err)
+			log.Printf("PostHandler: failed to read body from %s (app=%s): %v", logIP, app.ID, err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		log.Printf("PostHandler: body received (app=%s): %s", app.ID, body)
 
 		var event models.Event
 		if err := json.Unmarshal(body, &event); err != nil {
-			log.Printf("PostHandler: failed to decode event from %s (app=%s): %v", clientIP, app.ID, err)
+			log.Printf("PostHandler: failed to decode event from %s (app=%s): %v", logIP, app.ID, err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		h.enrichEvent(&event, app.ID, r)
-
-		h.appMgr.AddEvent(&event)
-		if err := h.saveEvent(&event, app.ID); err != nil {
+		duplicate, retryAfter, err := h.trackOnce(&event, app, r)
+		var schemaErr *schemaError
+		if errors.As(err, &schemaErr) {
+			log.Printf("PostHandler: event rejected by schema (app=%s, event=%s): %v", app.ID, event.EventName, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":  "rejected",
+				"reasons": schemaErr.reasons,
+			})
+			return
+		}
+		if err != nil {
 			log.Printf("PostHandler: failed to save event (app=%s, eventID=%s): %v", app.ID, event.EventID, err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		if retryAfter > 0 {
+			log.Printf("PostHandler: quota exceeded from %s (app=%s)", logIP, app.ID)
+			writeTooManyRequests(w, retryAfter)
+			return
+		}
+		if duplicate {
+			log.Printf("PostHandler: duplicate event ignored (app=%s, eventID=%s)", app.ID, event.EventID)
+		}
 
 		// log.Printf("PostHandler: event saved (app=%s, eventID=%s)", app.ID, event.EventID)
 
@@ -87,19 +147,160 @@ func (h *EventTracker) PostHandler() http.HandlerFunc {
 	}
 }
 
-// saveEvent saves an event as a JSON file in data/<app-id>/<utc-date-YYYYMMDD>/<eventid>.json.
-func (h *EventTracker) saveEvent(event *models.Event, appID string) error {
-	dateStr := time.Now().UTC().Format("20060102")
-	filePath := filepath.Join("data", appID, dateStr, fmt.Sprintf("%s.json", event.EventID))
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return fmt.Errorf("create directories for %s: %w", filePath, err)
+// authorizePost checks the method and API key shared by the tracking endpoints.
+// On failure it writes the status code and returns false.
+func (h *EventTracker) authorizePost(w http.ResponseWriter, r *http.Request, handler, clientIP string) (*apps.App, bool) {
+	if r.Method != http.MethodPost {
+		log.Printf("%s: method not allowed: %s from %s", handler, r.Method, h.logIP(clientIP, nil))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, false
 	}
-	eventJSON, err := json.Marshal(event)
+
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		log.Printf("%s: missing API key from %s", handler, h.logIP(clientIP, nil))
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	app, err := h.appMgr.GetAppByAPIKey(apiKey, apps.ScopeIngest)
 	if err != nil {
-		return fmt.Errorf("marshal event: %w", err)
+		log.Printf("%s: invalid API key (...%s) from %s", handler, apps.KeyHint(apiKey), h.logIP(clientIP, nil))
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return app, true
+}
+
+// limitRate takes n events from the token buckets of the request's API key and
+// client IP. If either is empty it counts the events as rate limited, writes
+// 429 with Retry-After and returns false; tokens the key's bucket gave are
+// returned when the IP's bucket refuses.
+func (h *EventTracker) limitRate(w http.ResponseWriter, r *http.Request, handler string, app *apps.App, clientIP string, n int) bool {
+	now := time.Now()
+	apiKey := r.Header.Get("X-API-Key")
+	ok, retryAfter := h.keyLimiter.take(apiKey, n, now)
+	if ok {
+		ok, retryAfter = h.ipLimiter.take(clientIP, n, now)
+		if !ok {
+			// One abusive IP must not use up the budget of everyone sharing the key
+			h.keyLimiter.refund(apiKey, n)
+		}
+	}
+	if ok {
+		return true
+	}
+
+	log.Printf("%s: rate limited %d events from %s (app=%s)", handler, n, h.logIP(clientIP, app), app.ID)
+	h.appMgr.RecordRateLimited(app.ID, n)
+	writeTooManyRequests(w, retryAfter)
+	return false
+}
+
+// writeTooManyRequests writes 429 with Retry-After rounded up to whole seconds.
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// trackOnce tracks an event within the app's quota, unless its client-supplied
+// event ID was already accepted for the app within the dedup window. Duplicates
+// are reported as such and not counted against the quota, nor are bot events
+// the app's policy drops or events its schema rejects, for which a *schemaError
+// is returned. Events of users whose events were erased are dropped the same
+// way. If the quota is exhausted nothing is tracked and retryAfter says when
+// it resets.
+func (h *EventTracker) trackOnce(event *models.Event, app *apps.App, r *http.Request) (duplicate bool, retryAfter time.Duration, err error) {
+	if h.appMgr.IsErased(app.ID, event) {
+		return false, 0, nil
+	}
+
+	eventID := event.EventID
+	if !h.dedup.claim(app.ID, eventID, time.Now()) {
+		return true, 0, nil
+	}
+
+	botPolicy := h.appMgr.BotPolicy(app.ID)
+	reason := h.bots.classify(event, r, h.clientIP(r))
+	event.IsBot = reason != ""
+	if event.IsBot {
+		h.appMgr.RecordBot(app.ID, reason)
+		if botPolicy == apps.BotPolicyDrop {
+			h.dedup.release(app.ID, eventID)
+			return false, 0, nil
+		}
+	}
+
+	privacy := h.appMgr.Privacy(app.ID)
+	h.enrichEvent(event, app.ID, r)
+	event.User.AnonymousIDDerived = false // only the server sets it
+	if privacy.CookielessVisitors {
+		h.deriveVisitorID(event, app.ID, r)
+	}
+
+	// Validated after enrichment, so recorded violations carry the event ID and
+	// user fields the server filled in
+	mode, violations := h.appMgr.ValidateEvent(app.ID, event)
+	event.SchemaViolations = nil
+	if len(violations) > 0 {
+		if mode == apps.SchemaModeEnforce {
+			h.dedup.release(app.ID, eventID)
+			return false, 0, &schemaError{violations}
+		}
+		event.SchemaViolations = violations
+	}
+
+	if granted, retryAfter := h.appMgr.ReserveQuota(app.ID, 1); granted == 0 {
+		h.dedup.release(app.ID, eventID)
+		return false, retryAfter, nil
+	}
+
+	if err := h.trackEvent(event, app, privacy, botPolicy); err != nil {
+		h.dedup.release(app.ID, eventID)
+		return false, 0, err
+	}
+	h.dedup.commit(app.ID, eventID)
+	return false, 0, nil
+}
+
+// schemaError rejects an event that does not match its app's schema.
+type schemaError struct {
+	reasons []string
+}
+
+func (e *schemaError) Error() string {
+	return "schema violation: " + strings.Join(e.reasons, "; ")
+}
+
+// trackEvent applies the privacy settings and redaction rules to an enriched
+// event and hands it to the cache and disk. Bot events of apps keeping them
+// separate only go to disk, under the app's bots namespace.
+func (h *EventTracker) trackEvent(event *models.Event, app *apps.App, privacy apps.Privacy, botPolicy apps.BotPolicy) error {
+	h.applyPrivacy(event, app.ID, privacy)
+
+	// Scrub personal data before the event reaches the cache or disk; an event
+	// that cannot be scrubbed is not kept at all
+	if err := h.appMgr.RedactEvent(app.ID, event); err != nil {
+		return fmt.Errorf("redact event: %w", err)
+	}
+
+	if event.IsBot && botPolicy == apps.BotPolicySeparate {
+		return h.saveEvent(event, apps.BotsStoreID(app.ID))
 	}
-	if err := os.WriteFile(filePath, eventJSON, 0644); err != nil {
-		return fmt.Errorf("save event to %s: %w", filePath, err)
+	h.appMgr.AddEvent(event)
+	return h.saveEvent(event, app.ID)
+}
+
+// saveEvent appends an event to the app's event store.
+func (h *EventTracker) saveEvent(event *models.Event, appID string) error {
+	if err := h.events.Append(appID, event); err != nil {
+		return fmt.Errorf("save event: %w", err)
 	}
 	return nil
 }
@@ -138,16 +339,22 @@ func (h *EventTracker) enrichEvent(event *models.Event, appID string, r *http.Re
 	}
 
 	// Extract client IP
-	clientIP := extractClientIP(r)
+	clientIP := h.clientIP(r)
 
 	// Set location if not provided
 	if event.Location == nil {
 		event.Location = &models.LocationInfo{
 			IP: clientIP,
-			// TODO: Add GeoIP lookup
 		}
 	}
 
+	// Locate the client from its IP, overriding any self-reported location
+	if loc, ok := h.geo.Lookup(net.ParseIP(clientIP)); ok {
+		event.Location.Country = loc.Country
+		event.Location.Region = loc.Region
+		event.Location.City = loc.City
+	}
+
 	// For web events, capture user agent
 	if event.Device.Platform == "web" && event.Web != nil {
 		if event.Web.UserAgent == "" {
@@ -157,21 +364,14 @@ func (h *EventTracker) enrichEvent(event *models.Event, appID string, r *http.Re
 			event.Web.Referrer = r.Referer()
 		}
 	}
-}
 
-func extractClientIP(r *http.Request) string {
-	// Check X-Forwarded-For
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		return strings.TrimSpace(parts[0])
-	}
-
-	// Check X-Real-IP
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	// Derive browser, OS and device class from the user agent
+	if event.Web != nil && event.Web.UserAgent != "" {
+		fillDevice(&event.Device, parseUserAgent(event.Web.UserAgent))
 	}
+}
 
-	// Fall back to RemoteAddr
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return ip
+// clientIP returns the IP of the client that sent a request, see clientIPResolver.
+func (h *EventTracker) clientIP(r *http.Request) string {
+	return h.proxies.resolve(r)
 }
@@ -0,0 +1,122 @@
+package tracker
+
+import (
+	"regexp"
+	"strings"
+
+	"analytics/models"
+)
+
+// userAgent is what parseUserAgent extracts from a User-Agent header.
+type userAgent struct {
+	Browser        string
+	BrowserVersion string
+	OSName         string
+	OSVersion      string
+	DeviceClass    string
+}
+
+// uaRule names a browser or OS when its pattern matches. The first
+// submatch, if any, is the version.
+type uaRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// Rules are tried in order, so more specific products come first: Edge and
+// Opera also claim to be Chrome, and Chrome also claims to be Safari.
+var browserRules = []uaRule{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+	{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+}
+
+// iOS devices claim to be "like Mac OS X" and Android is Linux, so they come first.
+var osRules = []uaRule{
+	{"Windows", regexp.MustCompile(`Windows NT ([\d.]+)`)},
+	{"iOS", regexp.MustCompile(`(?:iPhone|iPad|iPod).*? OS ([\d_]+)`)},
+	{"macOS", regexp.MustCompile(`Mac OS X ([\d_.]+)`)},
+	{"Android", regexp.MustCompile(`Android ([\d.]+)`)},
+	{"ChromeOS", regexp.MustCompile(`CrOS \S+ ([\d.]+)`)},
+	{"Linux", regexp.MustCompile(`Linux`)},
+}
+
+// windowsVersions maps Windows NT kernel versions to marketing names.
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+var (
+	botPattern    = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|bingpreview|facebookexternalhit|headless|lighthouse|phantomjs|curl/|wget/|python-requests|go-http-client|okhttp|axios/|java/|scrapy`)
+	tabletPattern = regexp.MustCompile(`iPad|Tablet|Kindle|Silk/|PlayBook`)
+	mobilePattern = regexp.MustCompile(`Mobi|iPhone|iPod|Android|Windows Phone`)
+)
+
+// parseUserAgent extracts the browser, OS and device class from a User-Agent
+// header. Fields it cannot determine are left empty.
+func parseUserAgent(header string) userAgent {
+	var ua userAgent
+	if header == "" {
+		return ua
+	}
+
+	ua.Browser, ua.BrowserVersion = matchRules(browserRules, header)
+	ua.OSName, ua.OSVersion = matchRules(osRules, header)
+	ua.OSVersion = strings.ReplaceAll(ua.OSVersion, "_", ".")
+	if ua.OSName == "Windows" {
+		if name, ok := windowsVersions[ua.OSVersion]; ok {
+			ua.OSVersion = name
+		}
+	}
+
+	switch {
+	case botPattern.MatchString(header):
+		ua.DeviceClass = models.DeviceClassBot
+	case tabletPattern.MatchString(header), ua.OSName == "Android" && !strings.Contains(header, "Mobile"):
+		ua.DeviceClass = models.DeviceClassTablet
+	case mobilePattern.MatchString(header):
+		ua.DeviceClass = models.DeviceClassMobile
+	default:
+		ua.DeviceClass = models.DeviceClassDesktop
+	}
+	return ua
+}
+
+// matchRules returns the name and version of the first matching rule.
+func matchRules(rules []uaRule, header string) (string, string) {
+	for _, rule := range rules {
+		if match := rule.pattern.FindStringSubmatch(header); match != nil {
+			if len(match) > 1 {
+				return rule.name, match[1]
+			}
+			return rule.name, ""
+		}
+	}
+	return "", ""
+}
+
+// fillDevice sets the device fields the client did not send from the parsed User-Agent.
+func fillDevice(device *models.DeviceInfo, ua userAgent) {
+	if device.Browser == "" {
+		device.Browser = ua.Browser
+		device.BrowserVersion = ua.BrowserVersion
+	}
+	if device.OSName == "" {
+		device.OSName = ua.OSName
+		if device.OSVersion == "" {
+			device.OSVersion = ua.OSVersion
+		}
+	}
+	if device.DeviceClass == "" {
+		device.DeviceClass = ua.DeviceClass
+	}
+}
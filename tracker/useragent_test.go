@@ -0,0 +1,87 @@
+package tracker
+
+import (
+	"analytics/models"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected userAgent
+	}{
+		{
+			name:     "chrome on windows",
+			header:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.109 Safari/537.36",
+			expected: userAgent{"Chrome", "120.0.6099.109", "Windows", "10", models.DeviceClassDesktop},
+		},
+		{
+			name:     "edge on windows",
+			header:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			expected: userAgent{"Edge", "120.0.2210.91", "Windows", "10", models.DeviceClassDesktop},
+		},
+		{
+			name:     "safari on iphone",
+			header:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1",
+			expected: userAgent{"Safari", "17.1.2", "iOS", "17.1.2", models.DeviceClassMobile},
+		},
+		{
+			name:     "safari on ipad",
+			header:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			expected: userAgent{"Safari", "16.6", "iOS", "16.6", models.DeviceClassTablet},
+		},
+		{
+			name:     "firefox on macos",
+			header:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0",
+			expected: userAgent{"Firefox", "121.0", "macOS", "10.15", models.DeviceClassDesktop},
+		},
+		{
+			name:     "chrome on android phone",
+			header:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+			expected: userAgent{"Chrome", "120.0.6099.144", "Android", "14", models.DeviceClassMobile},
+		},
+		{
+			name:     "android tablet",
+			header:   "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36",
+			expected: userAgent{"Samsung Internet", "23.0", "Android", "13", models.DeviceClassTablet},
+		},
+		{
+			name:     "googlebot",
+			header:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected: userAgent{DeviceClass: models.DeviceClassBot},
+		},
+		{
+			name:     "curl",
+			header:   "curl/8.4.0",
+			expected: userAgent{DeviceClass: models.DeviceClassBot},
+		},
+		{
+			name:   "empty",
+			header: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseUserAgent(tt.header); got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFillDeviceKeepsClientValues(t *testing.T) {
+	device := models.DeviceInfo{Platform: "web", Browser: "Custom", DeviceClass: models.DeviceClassTablet}
+	fillDevice(&device, userAgent{"Chrome", "120.0", "Windows", "10", models.DeviceClassDesktop})
+
+	if device.Browser != "Custom" || device.BrowserVersion != "" {
+		t.Errorf("Expected client browser to be kept, got %s %s", device.Browser, device.BrowserVersion)
+	}
+	if device.OSName != "Windows" || device.OSVersion != "10" {
+		t.Errorf("Expected OS to be filled, got %s %s", device.OSName, device.OSVersion)
+	}
+	if device.DeviceClass != models.DeviceClassTablet {
+		t.Errorf("Expected client device class to be kept, got %s", device.DeviceClass)
+	}
+}